@@ -0,0 +1,336 @@
+// Package brcode encodes and parses EMV MPM payloads in the BR Code layout used by PIX.
+package brcode
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Top level tags
+const (
+	tagPayloadFormat        = "00"
+	tagPointOfInitiation    = "01"
+	tagMerchantAccount      = "26"
+	tagMerchantCategory     = "52"
+	tagCurrency             = "53"
+	tagAmount               = "54"
+	tagCountryCode          = "58"
+	tagMerchantName         = "59"
+	tagMerchantCity         = "60"
+	tagAdditionalData       = "62"
+	tagCRC                  = "63"
+	tagFirstUnreserved      = "80"
+	tagLastUnreserved       = "99"
+	subTagGUI               = "00"
+	subTagKey               = "01"
+	subTagDescription       = "02"
+	subTagTxID              = "05"
+	maxMerchantNameLength   = 25
+	maxMerchantCityLength   = 15
+	maxTxIDLength           = 25
+	maxFieldLength          = 99
+	InitiationStatic        = "11" // Reusable code
+	InitiationDynamic       = "12" // Single use code
+	DefaultMerchantCategory = "0000"
+)
+
+var (
+	ErrInvalidPayload = errors.New("brcode: invalid payload")
+	ErrInvalidCRC     = errors.New("brcode: checksum mismatch")
+	ErrFieldTooLong   = errors.New("brcode: field too long")
+)
+
+// ISO 4217 numeric codes for the currencies the wallets support
+var numericCurrencies = map[string]string{
+	"BRL": "986",
+	"USD": "840",
+	"EUR": "978",
+	"GBP": "826",
+	"ARS": "032",
+}
+
+// Extension is an unreserved template (tags 80 to 99) carrying issuer specific data.
+type Extension struct {
+	Tag    string
+	GUI    string
+	Fields map[string]string // Sub-tags 01 to 99
+}
+
+// Payload is the content of a BR Code.
+type Payload struct {
+	Initiation       string // InitiationStatic or InitiationDynamic
+	GUI              string // Domain of the account arrangement, e.g. "br.gov.bcb.pix"
+	Key              string // Account key within the arrangement
+	Description      string
+	MerchantCategory string   // MCC, DefaultMerchantCategory when unknown
+	Currency         string   // ISO 4217 alpha code
+	Amount           *float64 // Nil lets the payer type the amount
+	MerchantName     string
+	MerchantCity     string
+	TxID             string
+	Extensions       []Extension
+}
+
+// Encode renders the payload as a TLV string ending with its CRC16 checksum.
+func (p Payload) Encode() (string, error) {
+	if p.GUI == "" || p.Key == "" {
+		return "", ErrInvalidPayload
+	}
+	currency, ok := numericCurrencies[strings.ToUpper(p.Currency)]
+	if !ok {
+		return "", fmt.Errorf("brcode: unsupported currency %q", p.Currency)
+	}
+	mcc := p.MerchantCategory
+	if mcc == "" {
+		mcc = DefaultMerchantCategory
+	}
+	txID := sanitizeTxID(p.TxID)
+	if txID == "" {
+		txID = "***" // Marks a code without transaction id
+	}
+
+	var account tlv
+	account.add(subTagGUI, p.GUI)
+	account.add(subTagKey, p.Key)
+	if p.Description != "" {
+		account.add(subTagDescription, p.Description)
+	}
+	var additional tlv
+	additional.add(subTagTxID, txID)
+
+	var b tlv
+	b.add(tagPayloadFormat, "01")
+	if p.Initiation != "" {
+		b.add(tagPointOfInitiation, p.Initiation)
+	}
+	b.addTemplate(tagMerchantAccount, &account)
+	b.add(tagMerchantCategory, mcc)
+	b.add(tagCurrency, currency)
+	if p.Amount != nil {
+		b.add(tagAmount, strconv.FormatFloat(*p.Amount, 'f', 2, 64))
+	}
+	b.add(tagCountryCode, "BR")
+	b.add(tagMerchantName, truncate(normalize(p.MerchantName), maxMerchantNameLength))
+	b.add(tagMerchantCity, truncate(normalize(p.MerchantCity), maxMerchantCityLength))
+	b.addTemplate(tagAdditionalData, &additional)
+	extensions := append([]Extension(nil), p.Extensions...)
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].Tag < extensions[j].Tag })
+	for _, ext := range extensions {
+		if ext.Tag < tagFirstUnreserved || ext.Tag > tagLastUnreserved {
+			return "", fmt.Errorf("brcode: tag %q is not an unreserved template", ext.Tag)
+		}
+		subTags := make([]string, 0, len(ext.Fields))
+		for tag := range ext.Fields {
+			subTags = append(subTags, tag)
+		}
+		sort.Strings(subTags)
+		var value tlv
+		value.add(subTagGUI, ext.GUI)
+		for _, tag := range subTags {
+			value.add(tag, ext.Fields[tag])
+		}
+		b.addTemplate(ext.Tag, &value)
+	}
+	if b.err != nil {
+		return "", b.err
+	}
+	encoded := b.String() + tagCRC + "04"
+	return encoded + fmt.Sprintf("%04X", crc16(encoded)), nil
+}
+
+// Parse decodes a BR Code, verifying its checksum.
+func Parse(s string) (Payload, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 || s[len(s)-8:len(s)-4] != tagCRC+"04" {
+		return Payload{}, ErrInvalidPayload
+	}
+	if fmt.Sprintf("%04X", crc16(s[:len(s)-4])) != strings.ToUpper(s[len(s)-4:]) {
+		return Payload{}, ErrInvalidCRC
+	}
+	fields, err := parseTLV(s[:len(s)-8])
+	if err != nil {
+		return Payload{}, err
+	}
+	if fields[tagPayloadFormat] != "01" {
+		return Payload{}, ErrInvalidPayload
+	}
+	p := Payload{
+		Initiation:       fields[tagPointOfInitiation],
+		MerchantCategory: fields[tagMerchantCategory],
+		MerchantName:     fields[tagMerchantName],
+		MerchantCity:     fields[tagMerchantCity],
+	}
+	for alpha, numeric := range numericCurrencies {
+		if numeric == fields[tagCurrency] {
+			p.Currency = alpha
+		}
+	}
+	if p.Currency == "" {
+		return Payload{}, fmt.Errorf("brcode: unsupported currency %q", fields[tagCurrency])
+	}
+	if raw, ok := fields[tagAmount]; ok {
+		amount, err := strconv.ParseFloat(raw, 64)
+		if err != nil || amount <= 0 {
+			return Payload{}, ErrInvalidPayload
+		}
+		p.Amount = &amount
+	}
+	account, err := parseTLV(fields[tagMerchantAccount])
+	if err != nil {
+		return Payload{}, err
+	}
+	p.GUI, p.Key, p.Description = account[subTagGUI], account[subTagKey], account[subTagDescription]
+	if p.GUI == "" {
+		return Payload{}, ErrInvalidPayload
+	}
+	if extra, ok := fields[tagAdditionalData]; ok {
+		data, err := parseTLV(extra)
+		if err != nil {
+			return Payload{}, err
+		}
+		if data[subTagTxID] != "***" {
+			p.TxID = data[subTagTxID]
+		}
+	}
+	for tag := tagFirstUnreserved; tag <= tagLastUnreserved; tag = nextTag(tag) {
+		raw, ok := fields[tag]
+		if !ok {
+			continue
+		}
+		sub, err := parseTLV(raw)
+		if err != nil {
+			return Payload{}, err
+		}
+		ext := Extension{Tag: tag, GUI: sub[subTagGUI], Fields: make(map[string]string)}
+		for k, v := range sub {
+			if k != subTagGUI {
+				ext.Fields[k] = v
+			}
+		}
+		p.Extensions = append(p.Extensions, ext)
+	}
+	return p, nil
+}
+
+// Extension returns the unreserved template with the given GUI, if present.
+func (p Payload) Extension(gui string) (Extension, bool) {
+	for _, ext := range p.Extensions {
+		if ext.GUI == gui {
+			return ext, true
+		}
+	}
+	return Extension{}, false
+}
+
+func nextTag(tag string) string {
+	n, _ := strconv.Atoi(tag)
+	return fmt.Sprintf("%02d", n+1)
+}
+
+// tlv builds a list of TLV fields. The length has two digits, so a value over maxFieldLength
+// can't be encoded: the first one is kept in err and nothing more is added.
+type tlv struct {
+	strings.Builder
+	err error
+}
+
+func (t *tlv) add(tag, value string) {
+	if t.err != nil {
+		return
+	}
+	if len(value) > maxFieldLength {
+		t.err = fmt.Errorf("%w: field %s is %d bytes long, the limit is %d", ErrFieldTooLong, tag, len(value), maxFieldLength)
+		return
+	}
+	fmt.Fprintf(t, "%s%02d%s", tag, len(value), value)
+}
+
+// addTemplate adds a field whose value is the TLV list of sub.
+func (t *tlv) addTemplate(tag string, sub *tlv) {
+	if t.err == nil && sub.err != nil {
+		t.err = fmt.Errorf("template %s: %w", tag, sub.err)
+		return
+	}
+	t.add(tag, sub.String())
+}
+
+func parseTLV(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(s) > 0 {
+		if len(s) < 4 {
+			return nil, ErrInvalidPayload
+		}
+		if !isDigit(s[2]) || !isDigit(s[3]) {
+			return nil, ErrInvalidPayload
+		}
+		size := int(s[2]-'0')*10 + int(s[3]-'0')
+		if len(s) < 4+size {
+			return nil, ErrInvalidPayload
+		}
+		fields[s[:2]] = s[4 : 4+size]
+		s = s[4+size:]
+	}
+	return fields, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// crc16 is CRC-16/CCITT-FALSE (polynomial 0x1021, initial value 0xFFFF), as the BR Code spec requires.
+func crc16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "ê", "e", "è", "e", "í", "i", "ì", "i", "î", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ò", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u", "ç", "c", "ñ", "n",
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A", "Ä", "A",
+	"É", "E", "Ê", "E", "È", "E", "Í", "I", "Ì", "I", "Î", "I",
+	"Ó", "O", "Ô", "O", "Õ", "O", "Ò", "O", "Ö", "O",
+	"Ú", "U", "Ù", "U", "Û", "U", "Ü", "U", "Ç", "C", "Ñ", "N",
+)
+
+// normalize keeps names within the ASCII subset payer apps read reliably.
+func normalize(s string) string {
+	s = accents.Replace(s)
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func sanitizeTxID(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, s)
+	return truncate(s, maxTxIDLength)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package brcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Example from the BR Code manual of the Banco Central do Brasil
+const bcbExample = "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  uint16
+	}{
+		{"empty", "", 0xFFFF},
+		{"CCITT-FALSE check value", "123456789", 0x29B1},
+		{"single byte", "A", 0xB915},
+		{"BCB example", strings.TrimSuffix(bcbExample, "1D3D"), 0x1D3D},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16(tt.input); got != tt.want {
+				t.Errorf("crc16(%q) = %04X, want %04X", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	amount := 10.5
+	tests := []struct {
+		name    string
+		payload Payload
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "BCB example",
+			payload: Payload{GUI: "br.gov.bcb.pix", Key: "123e4567-e12b-12d1-a456-426655440000", Currency: "BRL", MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"},
+			want:    bcbExample,
+		},
+		{
+			// GUI and key take 10 bytes of the merchant account template, the description header 4
+			name:    "merchant account of 99 bytes fits",
+			payload: Payload{GUI: "g", Key: "k", Currency: "BRL", Description: strings.Repeat("d", 85)},
+		},
+		{
+			name:    "merchant account over 99 bytes",
+			payload: Payload{GUI: "g", Key: "k", Currency: "BRL", Description: strings.Repeat("d", 86)},
+			wantErr: ErrFieldTooLong,
+		},
+		{
+			name:    "field over 99 bytes",
+			payload: Payload{GUI: "g", Key: "k", Currency: "BRL", Description: strings.Repeat("d", 100)},
+			wantErr: ErrFieldTooLong,
+		},
+		{
+			name:    "template over 99 bytes",
+			payload: Payload{GUI: "g", Key: "k", Currency: "BRL", Amount: &amount, Extensions: []Extension{{Tag: "80", GUI: "x", Fields: map[string]string{"01": strings.Repeat("a", 60), "02": strings.Repeat("b", 40)}}}},
+			wantErr: ErrFieldTooLong,
+		},
+		{
+			name:    "missing key",
+			payload: Payload{GUI: "g", Currency: "BRL"},
+			wantErr: ErrInvalidPayload,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.payload.Encode()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("Encode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	amount := 25.9
+	encoded, err := Payload{
+		Initiation:   InitiationDynamic,
+		GUI:          "br.com.pagcore",
+		Key:          "maria",
+		Description:  "Almoço",
+		Currency:     "USD",
+		Amount:       &amount,
+		MerchantName: "Café São João",
+		MerchantCity: "São Paulo",
+		TxID:         "abc-123",
+		Extensions:   []Extension{{Tag: "80", GUI: "br.com.pagcore", Fields: map[string]string{"01": "sig"}}},
+	}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"round trip", encoded, nil},
+		{"lower case checksum", encoded[:len(encoded)-4] + strings.ToLower(encoded[len(encoded)-4:]), nil},
+		{"tampered content", strings.Replace(encoded, "maria", "mario", 1), ErrInvalidCRC},
+		{"no checksum", encoded[:len(encoded)-8], ErrInvalidPayload},
+		{"BCB example", bcbExample, nil},
+		{"negative length", withCRC("0002015303986" + "26-1xxxxx" + "6304"), ErrInvalidPayload},
+		{"signed length", withCRC("0002015303986" + "26+1xxxxx" + "6304"), ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil || tt.input != encoded {
+				return
+			}
+			if p.Key != "maria" || p.Currency != "USD" || p.Amount == nil || *p.Amount != amount || p.TxID != "abc123" {
+				t.Errorf("Parse = %+v", p)
+			}
+			if p.MerchantName != "Cafe Sao Joao" || p.MerchantCity != "Sao Paulo" {
+				t.Errorf("names not normalized: %q, %q", p.MerchantName, p.MerchantCity)
+			}
+			if ext, ok := p.Extension("br.com.pagcore"); !ok || ext.Fields["01"] != "sig" {
+				t.Errorf("extension = %+v, %t", ext, ok)
+			}
+		})
+	}
+}
+
+func withCRC(s string) string {
+	return s + fmt.Sprintf("%04X", crc16(s))
+}
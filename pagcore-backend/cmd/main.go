@@ -1,10 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/controllers"
+	"github.com/Santannafe12/pagcore-backend/events"
+	"github.com/Santannafe12/pagcore-backend/jobs"
+	"github.com/Santannafe12/pagcore-backend/outbox"
 	"github.com/Santannafe12/pagcore-backend/routes"
+	"github.com/Santannafe12/pagcore-backend/webhooks"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +19,39 @@ import (
 func main() {
 	godotenv.Load()
 	config.ConnectDB()
+	config.LoadFX()
+	config.LoadQRSigningKey()
+	config.LoadQRLogo()
+	// "migrate" runs the one-off schema changes and data backfills, then exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		filled, err := controllers.BackfillQRPayloads()
+		if err != nil {
+			panic("Failed to backfill QR payloads: " + err.Error())
+		}
+		fmt.Printf("Backfilled %d QR payloads\n", filled)
+		if err := config.MigrateLegacy(); err != nil {
+			panic("Failed to migrate: " + err.Error())
+		}
+		return
+	}
+	jobs.Register(jobs.Job{Name: "expire_qr_codes", Interval: time.Minute, Run: jobs.ExpireQRCodes})
+	jobs.Register(jobs.Job{Name: "expire_payment_requests", Interval: time.Minute, Run: jobs.ExpirePaymentRequests})
+	jobs.Register(jobs.Job{Name: "expire_payment_links", Interval: time.Minute, Run: jobs.ExpirePaymentLinks})
+	jobs.Register(jobs.Job{Name: "delete_expired_sessions", Interval: time.Hour, Run: jobs.DeleteExpiredSessions})
+	jobs.Register(jobs.Job{Name: "delete_expired_stream_tickets", Interval: time.Hour, Run: jobs.DeleteExpiredStreamTickets})
+	outbox.Register(webhooks.Sink{})
+	outbox.Register(events.NotifySink{})
+	events.Watch(controllers.InvalidateAnalytics)
+	events.Listen(config.DB)
+	if os.Getenv("OUTBOX_LOG_EVENTS") == "true" {
+		outbox.Register(outbox.LogSink{})
+	}
+	jobs.Register(jobs.Job{Name: "relay_outbox", Interval: time.Second, Run: outbox.Relay})
+	jobs.Register(jobs.Job{Name: "deliver_webhooks", Interval: 5 * time.Second, Run: webhooks.DeliverDue, OwnTransactions: true})
+	jobs.Register(jobs.Job{Name: "email_notifications", Interval: 30 * time.Second, Run: controllers.SendNotificationEmails, OwnTransactions: true})
+	jobs.Register(jobs.Job{Name: "settle_merchants", Interval: time.Hour, Run: controllers.SettleDueMerchants, OwnTransactions: true})
+	jobs.Register(jobs.Job{Name: "close_statements", Interval: time.Hour, Run: controllers.CloseStatements, OwnTransactions: true})
+	jobs.Start()
 	r := routes.SetupRouter()
 	r.Run(":" + os.Getenv("PORT"))
 }
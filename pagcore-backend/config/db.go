@@ -33,16 +33,41 @@ func ConnectDB() {
 
 	// Connect to the database
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic("Failed to connect to database: " + err.Error())
 	}
 
 	// Auto-migrate models
-	err = DB.AutoMigrate(&models.User{}, &models.QRCode{}, &models.Transaction{}, &models.PaymentRequest{}, &models.Session{})
+	err = DB.AutoMigrate(&models.User{}, &models.QRCode{}, &models.Transaction{}, &models.PaymentRequest{}, &models.Session{}, &models.PaymentGroup{}, &models.Wallet{}, &models.FeeSchedule{}, &models.FeeTier{}, &models.JobRun{}, &models.MerchantProfile{}, &models.MerchantStaff{}, &models.PaymentLink{}, &models.Invoice{}, &models.InvoiceItem{}, &models.WebhookEndpoint{}, &models.WebhookDelivery{}, &models.OutboxEvent{}, &models.Notification{}, &models.NotificationPreference{}, &models.UserDevice{}, &models.Statement{}, &models.StatementLine{}, &models.StreamTicket{})
 	if err != nil {
 		panic("Failed to auto-migrate database: " + err.Error())
 	}
 
+	// Numbers outbox events in the order the relay publishes them, see OutboxEvent.PublishSeq
+	if err := DB.Exec("CREATE SEQUENCE IF NOT EXISTS outbox_publish_seq").Error; err != nil {
+		panic("Failed to create outbox_publish_seq: " + err.Error())
+	}
+
+	// The legacy image column stays until "migrate" drops it, but new QR codes don't fill it
+	if DB.Migrator().HasColumn(&models.QRCode{}, "qr_code") {
+		if err := DB.Exec("ALTER TABLE qr_codes ALTER COLUMN qr_code DROP NOT NULL").Error; err != nil {
+			panic("Failed to relax qr_codes.qr_code: " + err.Error())
+		}
+	}
+
 	fmt.Println("Successfully connected to the database")
 }
+
+// MigrateLegacy drops what older versions stored and nothing reads anymore. It changes the
+// schema in ways a running older version can't cope with, so it only runs through
+// "migrate", never on a normal start.
+func MigrateLegacy() error {
+	// QR images used to be stored as base64 PNGs, they are rendered on demand now
+	if DB.Migrator().HasColumn(&models.QRCode{}, "qr_code") {
+		if err := DB.Migrator().DropColumn(&models.QRCode{}, "qr_code"); err != nil {
+			return fmt.Errorf("drop qr_codes.qr_code: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/Santannafe12/pagcore-backend/fx"
+)
+
+var FX fx.Converter
+
+// LoadFX sets up currency conversion from FX_RATES_FILE and FX_SPREAD (e.g. 0.01 for 1%).
+func LoadFX() {
+	provider := fx.NewMemoryProvider(nil)
+	if path := os.Getenv("FX_RATES_FILE"); path != "" {
+		var err error
+		provider, err = fx.LoadStaticFile(path)
+		if err != nil {
+			panic("Failed to load FX rates: " + err.Error())
+		}
+	}
+	spread := 0.0
+	if s := os.Getenv("FX_SPREAD"); s != "" {
+		var err error
+		spread, err = strconv.ParseFloat(s, 64)
+		if err != nil || spread < 0 || spread >= 1 {
+			panic("Invalid FX_SPREAD: " + s)
+		}
+	}
+	FX = fx.Converter{Provider: provider, Spread: spread}
+}
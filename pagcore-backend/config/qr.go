@@ -0,0 +1,50 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+var (
+	QRSigningKey ed25519.PrivateKey
+	QRLogo       image.Image // Optional logo drawn on QR images, nil when QR_LOGO_PATH is unset
+)
+
+// LoadQRSigningKey reads the Ed25519 seed used to sign QR payloads from QR_SIGNING_KEY (base64,
+// 32 bytes). Without it the key is derived from JWT_SECRET, which is fine for development only.
+func LoadQRSigningKey() {
+	if encoded := os.Getenv("QR_SIGNING_KEY"); encoded != "" {
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			panic("Invalid QR_SIGNING_KEY: expected a base64 encoded 32 byte seed")
+		}
+		QRSigningKey = ed25519.NewKeyFromSeed(seed)
+		return
+	}
+	fmt.Println("QR_SIGNING_KEY not set, deriving the QR signing key from JWT_SECRET")
+	seed := sha256.Sum256([]byte("pagcore-qr-signing:" + os.Getenv("JWT_SECRET")))
+	QRSigningKey = ed25519.NewKeyFromSeed(seed[:])
+}
+
+// LoadQRLogo reads the PNG logo QR images can embed from QR_LOGO_PATH.
+func LoadQRLogo() {
+	path := os.Getenv("QR_LOGO_PATH")
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		panic("Failed to open QR_LOGO_PATH: " + err.Error())
+	}
+	defer f.Close()
+	logo, err := png.Decode(f)
+	if err != nil {
+		panic("Invalid QR_LOGO_PATH: " + err.Error())
+	}
+	QRLogo = logo
+}
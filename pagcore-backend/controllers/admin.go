@@ -25,7 +25,7 @@ func BlockUser(c *gin.Context) {
 	var user models.User
 	if err := config.DB.First(&user, idStr).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -48,14 +48,38 @@ func GetStats(c *gin.Context) {
 		return
 	}
 
-	var totalTransactionVolume float64
-	if err := config.DB.Model(&models.Transaction{}).Select("SUM(amount)").Scan(&totalTransactionVolume).Error; err != nil {
+	var volumes []struct {
+		Currency string
+		Volume   float64
+	}
+	if err := config.DB.Model(&models.Transaction{}).Select("currency, SUM(amount) AS volume").
+		Group("currency").Scan(&volumes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction volume"})
 		return
 	}
+	// totalTransactionVolume stays in BRL, other currencies are reported separately
+	var totalTransactionVolume float64
+	volumeByCurrency := make(map[string]float64)
+	for _, v := range volumes {
+		volumeByCurrency[v.Currency] = v.Volume
+		if v.Currency == models.BaseCurrency {
+			totalTransactionVolume = v.Volume
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"totalUsers":             totalUsers,
 		"totalTransactionVolume": totalTransactionVolume,
+		"volumeByCurrency":       volumeByCurrency,
 	})
 }
+
+// GetJobRuns reports when each background job last ran, on whichever replica ran it.
+func GetJobRuns(c *gin.Context) {
+	var runs []models.JobRun
+	if err := config.DB.Order("name").Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	analyticsDayLayout     = "2006-01-02"
+	analyticsMaxDays       = 366
+	analyticsTopLimit      = 5
+	analyticsCacheTTL      = 10 * time.Minute
+	analyticsCachePerUser  = 20
+	analyticsCacheMaxUsers = 10000
+	// Brasília wall time of a transaction, the same fixed offset as invoiceZone
+	analyticsLocalTime = "created_at AT TIME ZONE INTERVAL '-03:00'"
+	analyticsIncome    = "CASE WHEN recipient_wallet_id = @wallet THEN COALESCE(converted_amount, amount) ELSE 0 END"
+	analyticsSpending  = "CASE WHEN sender_wallet_id = @wallet THEN amount ELSE 0 END"
+	analyticsMovements = "FROM transactions WHERE (sender_wallet_id = @wallet OR recipient_wallet_id = @wallet) " +
+		"AND status = @status AND created_at >= @from AND created_at < @to"
+	// Moving money between one's own wallets is neither income nor spending
+	analyticsFlows = analyticsMovements + " AND type <> @internal"
+)
+
+var analyticsPeriods = map[string]bool{"day": true, "week": true, "month": true}
+
+type analyticsEntry struct {
+	data    gin.H
+	expires time.Time
+}
+
+// analyticsCache keeps computed analytics per user. Entries are dropped when the user has new
+// events (see InvalidateAnalytics) and after analyticsCacheTTL in case a wake-up is missed.
+// Every invalidation bumps generation, so a result computed before one isn't stored after it.
+var analyticsCache = struct {
+	sync.Mutex
+	entries     map[uint]map[string]analyticsEntry
+	generation  uint64
+	invalidated map[uint]uint64 // Generation of the user's last invalidation
+	floor       uint64          // Generation invalidated was last emptied at, users not in it count as invalidated then
+}{entries: make(map[uint]map[string]analyticsEntry), invalidated: make(map[uint]uint64)}
+
+// InvalidateAnalytics forgets the cached analytics of the user. Every replica calls it when the
+// user's balance changes, through events.Watch.
+func InvalidateAnalytics(userID uint) {
+	analyticsCache.Lock()
+	defer analyticsCache.Unlock()
+	delete(analyticsCache.entries, userID)
+	if len(analyticsCache.invalidated) >= analyticsCacheMaxUsers {
+		analyticsCache.invalidated = make(map[uint]uint64)
+		analyticsCache.floor = analyticsCache.generation
+	}
+	analyticsCache.generation++
+	analyticsCache.invalidated[userID] = analyticsCache.generation
+}
+
+// analyticsGeneration is read before computing, and handed to cacheAnalytics with the result.
+func analyticsGeneration() uint64 {
+	analyticsCache.Lock()
+	defer analyticsCache.Unlock()
+	return analyticsCache.generation
+}
+
+func cachedAnalytics(userID uint, key string) (gin.H, bool) {
+	analyticsCache.Lock()
+	defer analyticsCache.Unlock()
+	entry, ok := analyticsCache.entries[userID][key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// cacheAnalytics stores data computed from the generation given, unless the user's analytics
+// were invalidated since.
+func cacheAnalytics(userID uint, key string, data gin.H, generation uint64) {
+	analyticsCache.Lock()
+	defer analyticsCache.Unlock()
+	if max(analyticsCache.invalidated[userID], analyticsCache.floor) > generation {
+		return
+	}
+	if len(analyticsCache.entries) >= analyticsCacheMaxUsers {
+		analyticsCache.entries = make(map[uint]map[string]analyticsEntry)
+	}
+	userEntries := analyticsCache.entries[userID]
+	if userEntries == nil || len(userEntries) >= analyticsCachePerUser {
+		userEntries = make(map[string]analyticsEntry)
+		analyticsCache.entries[userID] = userEntries
+	}
+	userEntries[key] = analyticsEntry{data: data, expires: time.Now().Add(analyticsCacheTTL)}
+}
+
+// bucketStart is the start, in Brasília time, of the day, ISO week or month t falls in.
+func bucketStart(t time.Time, period string) time.Time {
+	local := t.In(invoiceZone)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, invoiceZone)
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, invoiceZone)
+	}
+	return day
+}
+
+func nextBucket(t time.Time, period string) time.Time {
+	switch period {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+type analyticsRange struct {
+	From, To time.Time
+	Period   string
+}
+
+// parseAnalyticsRange reads from_date and to_date (RFC3339) and period (day, week, month). By
+// default it covers the current month and the five before it, by month.
+func parseAnalyticsRange(c *gin.Context, now time.Time) (analyticsRange, string) {
+	r := analyticsRange{To: now, Period: c.DefaultQuery("period", "month")}
+	if !analyticsPeriods[r.Period] {
+		return r, "Período inválido, use day, week ou month"
+	}
+	r.From = monthStart(now).AddDate(0, -5, 0)
+	if raw := c.Query("from_date"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return r, "Data inválida em from_date, use RFC3339"
+		}
+		r.From = t
+	}
+	if raw := c.Query("to_date"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return r, "Data inválida em to_date, use RFC3339"
+		}
+		if t.Before(now) {
+			r.To = t
+		}
+	}
+	if !r.To.After(r.From) {
+		return r, "to_date deve ser depois de from_date"
+	}
+	if r.To.Sub(r.From) > analyticsMaxDays*24*time.Hour {
+		return r, fmt.Sprintf("O intervalo máximo é de %d dias", analyticsMaxDays)
+	}
+	r.From, r.To = r.From.UTC(), r.To.UTC()
+	return r, ""
+}
+
+// GetAnalytics summarizes a wallet (wallet_id, default wallet otherwise) over a range: income
+// and spending per period, top counterparties, average ticket and the balance at the end of
+// every day.
+func GetAnalytics(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var walletID *uint
+	if raw := c.Query("wallet_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Carteira inválida"})
+			return
+		}
+		walletIDValue := uint(id)
+		walletID = &walletIDValue
+	}
+	wallet, err := resolveWallet(config.DB, userID, walletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao calcular análises")
+		return
+	}
+	now := time.Now().UTC()
+	r, msg := parseAnalyticsRange(c, now)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Open ranges end now, which moves every request, so they are cached by the minute
+	key := fmt.Sprintf("%d|%s|%s|%s", wallet.ID, r.Period, r.From.Format(time.RFC3339), r.To.Truncate(time.Minute).Format(time.RFC3339))
+	if data, ok := cachedAnalytics(userID, key); ok {
+		c.JSON(http.StatusOK, data)
+		return
+	}
+	generation := analyticsGeneration()
+	var data gin.H
+	// One snapshot for the balance and the history, without locking the wallet against payments
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		data, err = computeAnalytics(tx, &wallet, r)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao calcular análises"})
+		return
+	}
+	data["computed_at"] = now
+	cacheAnalytics(userID, key, data, generation)
+	c.JSON(http.StatusOK, data)
+}
+
+// computeAnalytics reads the wallet again along with its history, so run it in a REPEATABLE READ
+// transaction for the balance and the movements to agree.
+func computeAnalytics(tx *gorm.DB, wallet *models.Wallet, r analyticsRange) (gin.H, error) {
+	args := map[string]interface{}{
+		"wallet":   wallet.ID,
+		"status":   models.TransactionStatusCompleted,
+		"internal": models.TransactionTypeInternal,
+		"from":     r.From,
+		"to":       r.To,
+		"period":   r.Period,
+		"limit":    analyticsTopLimit,
+	}
+
+	var summary struct {
+		Income, Spending               float64
+		IncomeCount, SpendingCount     int64
+		AverageIncome, AverageSpending float64
+	}
+	err := tx.Raw("SELECT COALESCE(SUM("+analyticsIncome+"), 0) AS income, COALESCE(SUM("+analyticsSpending+"), 0) AS spending, "+
+		"COUNT(*) FILTER (WHERE recipient_wallet_id = @wallet) AS income_count, "+
+		"COUNT(*) FILTER (WHERE sender_wallet_id = @wallet) AS spending_count, "+
+		"COALESCE(AVG(COALESCE(converted_amount, amount)) FILTER (WHERE recipient_wallet_id = @wallet), 0) AS average_income, "+
+		"COALESCE(AVG(amount) FILTER (WHERE sender_wallet_id = @wallet), 0) AS average_spending "+analyticsFlows, args).
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []struct {
+		Period           string
+		Income, Spending float64
+		Count            int64
+	}
+	err = tx.Raw("SELECT to_char(date_trunc(@period, "+analyticsLocalTime+"), 'YYYY-MM-DD') AS period, "+
+		"SUM("+analyticsIncome+") AS income, SUM("+analyticsSpending+") AS spending, COUNT(*) AS count "+
+		analyticsFlows+" GROUP BY period", args).Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+	byPeriod := make(map[string]int, len(buckets))
+	for i, b := range buckets {
+		byPeriod[b.Period] = i
+	}
+	periods := []gin.H{}
+	for start := bucketStart(r.From, r.Period); start.Before(r.To); start = nextBucket(start, r.Period) {
+		key := start.Format(analyticsDayLayout)
+		entry := gin.H{"period": key, "income": 0.0, "spending": 0.0, "net": 0.0, "count": 0}
+		if i, ok := byPeriod[key]; ok {
+			b := buckets[i]
+			entry["income"] = fromCents(toCents(b.Income))
+			entry["spending"] = fromCents(toCents(b.Spending))
+			entry["net"] = fromCents(toCents(b.Income) - toCents(b.Spending))
+			entry["count"] = b.Count
+		}
+		periods = append(periods, entry)
+	}
+
+	var top []struct {
+		CounterpartyID           uint
+		Income, Spending, Volume float64
+		Count                    int64
+	}
+	err = tx.Raw("SELECT CASE WHEN sender_wallet_id = @wallet THEN recipient_id ELSE sender_id END AS counterparty_id, "+
+		"SUM("+analyticsIncome+") AS income, SUM("+analyticsSpending+") AS spending, "+
+		"SUM("+analyticsIncome+" + "+analyticsSpending+") AS volume, COUNT(*) AS count "+
+		analyticsFlows+" GROUP BY counterparty_id ORDER BY volume DESC, counterparty_id LIMIT @limit", args).Scan(&top).Error
+	if err != nil {
+		return nil, err
+	}
+	counterparties := make([]gin.H, 0, len(top))
+	for _, t := range top {
+		var user models.User
+		if err := tx.First(&user, t.CounterpartyID).Error; err != nil {
+			return nil, err
+		}
+		counterparties = append(counterparties, gin.H{
+			"username": user.Username,
+			"name":     displayName(&user),
+			"income":   fromCents(toCents(t.Income)),
+			"spending": fromCents(toCents(t.Spending)),
+			"count":    t.Count,
+		})
+	}
+
+	if err := tx.First(wallet, wallet.ID).Error; err != nil {
+		return nil, err
+	}
+	opening, err := balanceAt(tx, wallet, r.From)
+	if err != nil {
+		return nil, err
+	}
+	var days []struct {
+		Day string
+		Net float64
+	}
+	err = tx.Raw("SELECT to_char("+analyticsLocalTime+", 'YYYY-MM-DD') AS day, "+
+		"SUM("+analyticsIncome+" - "+analyticsSpending+") AS net "+analyticsMovements+" GROUP BY day", args).Scan(&days).Error
+	if err != nil {
+		return nil, err
+	}
+	netByDay := make(map[string]int64, len(days))
+	for _, d := range days {
+		netByDay[d.Day] = toCents(d.Net)
+	}
+	balance := toCents(opening)
+	series := []gin.H{}
+	for day := bucketStart(r.From, "day"); day.Before(r.To); day = day.AddDate(0, 0, 1) {
+		key := day.Format(analyticsDayLayout)
+		balance += netByDay[key]
+		series = append(series, gin.H{"date": key, "balance": fromCents(balance)})
+	}
+
+	return gin.H{
+		"wallet_id": wallet.ID,
+		"currency":  wallet.Currency,
+		"from":      r.From,
+		"to":        r.To,
+		"period":    r.Period,
+		"summary": gin.H{
+			"income":                  fromCents(toCents(summary.Income)),
+			"spending":                fromCents(toCents(summary.Spending)),
+			"net":                     fromCents(toCents(summary.Income) - toCents(summary.Spending)),
+			"income_count":            summary.IncomeCount,
+			"spending_count":          summary.SpendingCount,
+			"average_income_ticket":   fromCents(toCents(summary.AverageIncome)),
+			"average_spending_ticket": fromCents(toCents(summary.AverageSpending)),
+		},
+		"periods":            periods,
+		"top_counterparties": counterparties,
+		"opening_balance":    opening,
+		"daily_balance":      series,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type RegisterInput struct {
@@ -33,10 +35,17 @@ func Register(c *gin.Context) {
 		FullName: input.FullName,
 		Email:    input.Email,
 		Username: input.Username,
-		CPF:      input.CPF,
+		CPF:      &input.CPF,
 		Password: string(hashedPassword),
 	}
-	if err := config.DB.Create(&user).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		wallet := models.Wallet{UserID: user.ID, Name: models.DefaultWalletName, Currency: models.BaseCurrency, IsDefault: true}
+		return tx.Create(&wallet).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao registrar usuário"})
 		return
 	}
@@ -85,6 +94,12 @@ func Login(c *gin.Context) {
 		ExpiresAt: expirationTime,
 	}
 	config.DB.Create(&session)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return recordLoginDevice(tx, &user, c.Request.UserAgent(), c.ClientIP())
+	})
+	if err != nil {
+		fmt.Printf("Failed to record login device for user %d: %v\n", user.ID, err)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"token": tokenStr,
 		"role":  user.Role,
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/events"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	eventStreamHeartbeat = 15 * time.Second
+	eventStreamBatch     = 100
+	streamTicketTTL      = 30 * time.Second
+	streamTicketLength   = 32
+)
+
+// CreateStreamTicket issues a single-use ticket to open /events or /events/ws with the ticket
+// query parameter, so the session token never shows up in a URL.
+func CreateStreamTicket(c *gin.Context) {
+	code, err := randomToken(streamTicketLength)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao gerar ticket"})
+		return
+	}
+	ticket := models.StreamTicket{UserID: c.GetUint("user_id"), Ticket: code, ExpiresAt: time.Now().UTC().Add(streamTicketTTL)}
+	if err := config.DB.Create(&ticket).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao gerar ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket.Ticket, "expires_at": ticket.ExpiresAt})
+}
+
+// eventStreamStart is the publish sequence to stream after: the resume point when given,
+// otherwise the latest event of the user so only new events are sent.
+func eventStreamStart(userID uint, lastEventID string) int64 {
+	if seq, err := strconv.ParseInt(lastEventID, 10, 64); err == nil && seq >= 0 {
+		return seq
+	}
+	var latest int64
+	config.DB.Model(&models.OutboxEvent{}).Where("user_id = ?", userID).Select("COALESCE(MAX(publish_seq), 0)").Scan(&latest)
+	return latest
+}
+
+// streamUserEvents sends the user's published events after lastSeq, in publish order, and keeps
+// sending new ones until ctx is done or a send fails. The relay numbers events as it commits
+// them, so an event can't show up later behind one already sent.
+func streamUserEvents(ctx context.Context, userID uint, lastSeq int64, send func(*models.OutboxEvent) error, heartbeat func() error) error {
+	wake, cancel := events.Subscribe(userID)
+	defer cancel()
+	ticker := time.NewTicker(eventStreamHeartbeat)
+	defer ticker.Stop()
+	for {
+		for {
+			var batch []models.OutboxEvent
+			err := config.DB.Where("user_id = ? AND publish_seq > ?", userID, lastSeq).
+				Order("publish_seq").Limit(eventStreamBatch).Find(&batch).Error
+			if err != nil {
+				return err
+			}
+			for i := range batch {
+				if err := send(&batch[i]); err != nil {
+					return err
+				}
+				lastSeq = *batch[i].PublishSeq
+			}
+			if len(batch) < eventStreamBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamEvents pushes the user's events as Server-Sent Events. EventSource resends the last
+// id in Last-Event-ID when reconnecting, so nothing committed in between is missed.
+func StreamEvents(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	lastSeq := eventStreamStart(userID, lastEventID)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keep proxies from buffering the stream
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	send := func(e *models.OutboxEvent) error {
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", *e.PublishSeq, e.EventType, e.Payload); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	if err := streamUserEvents(c.Request.Context(), userID, lastSeq, send, heartbeat); err != nil {
+		fmt.Println("Event stream closed:", err)
+	}
+}
+
+type eventMessage struct {
+	ID        int64           `json:"id"` // Publish sequence, pass it back as last_event_id
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// StreamEventsWebSocket sends the same events over a WebSocket, one JSON message per event.
+// Resume with the last_event_id query parameter.
+func StreamEventsWebSocket(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	lastSeq := eventStreamStart(userID, c.Query("last_event_id"))
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		// The client doesn't send anything, reading just notices when it goes away
+		go func() {
+			var discard string
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+			cancel()
+		}()
+		send := func(e *models.OutboxEvent) error {
+			return websocket.JSON.Send(ws, eventMessage{ID: *e.PublishSeq, Type: e.EventType, CreatedAt: e.CreatedAt, Data: json.RawMessage(e.Payload)})
+		}
+		heartbeat := func() error {
+			return websocket.JSON.Send(ws, gin.H{"type": "ping"})
+		}
+		if err := streamUserEvents(ctx, userID, lastSeq, send, heartbeat); err != nil {
+			fmt.Println("Event socket closed:", err)
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
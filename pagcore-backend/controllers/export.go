@@ -0,0 +1,411 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/pdf"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportCSV = "csv"
+	exportOFX = "ofx"
+	exportPDF = "pdf"
+)
+
+var exportContentTypes = map[string]string{
+	exportCSV: "text/csv; charset=utf-8",
+	exportOFX: "application/x-ofx",
+	exportPDF: "application/pdf",
+}
+
+// exportFormat reads and checks the format query parameter, csv by default.
+func exportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", exportCSV)
+	if _, ok := exportContentTypes[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato inválido, use csv, ofx ou pdf"})
+		return "", false
+	}
+	return format, true
+}
+
+func startExport(c *gin.Context, format, name string) {
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	c.Status(http.StatusOK)
+}
+
+func exportAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// csvText keeps spreadsheets from running user text as a formula, by prefixing the cells that
+// start like one with an apostrophe.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportCounterparty is the other side of a movement as seen by whoever got amount.
+func exportCounterparty(t *models.Transaction, amount float64) string {
+	if amount < 0 {
+		return displayName(&t.Recipient)
+	}
+	return displayName(&t.Sender)
+}
+
+// ExportTransactions streams the user's transactions as CSV, OFX or PDF, oldest first. It takes
+// the filters of GetTransactionHistory. OFX holds a single account, so it covers wallet_id or the
+// default wallet.
+func ExportTransactions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	filter, msg := parseTxFilter(c, userID)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	var wallet models.Wallet
+	if format == exportOFX {
+		var walletID *uint
+		if filter.WalletID != 0 {
+			walletID = &filter.WalletID
+		}
+		var err error
+		if wallet, err = resolveWallet(config.DB, userID, walletID); err != nil {
+			walletErrorResponse(c, err, "Falha ao exportar transações")
+			return
+		}
+		filter.WalletID = wallet.ID
+	}
+	var user models.User
+	config.DB.First(&user, userID)
+	name := "transacoes-" + time.Now().In(invoiceZone).Format("20060102")
+	startExport(c, format, name)
+	var err error
+	switch format {
+	case exportCSV:
+		err = exportTransactionsCSV(c.Writer, filter)
+	case exportOFX:
+		err = exportTransactionsOFX(c.Writer, filter, &wallet)
+	case exportPDF:
+		err = exportTransactionsPDF(c.Writer, filter, &user)
+	}
+	if err != nil {
+		// Headers are gone already, all that is left is cutting the download short
+		fmt.Printf("Failed to export transactions of user %d: %v\n", userID, err)
+		c.Abort()
+	}
+}
+
+func exportTransactionsCSV(w gin.ResponseWriter, f txFilter) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "date", "type", "status", "description", "counterparty", "amount", "currency", "fee"})
+	n := 0
+	err := eachTx(f, func(t *models.Transaction) error {
+		amount, currency := f.userAmount(t)
+		fee := ""
+		if amount < 0 && t.Fee > 0 {
+			fee = exportAmount(t.Fee)
+		}
+		out.Write([]string{
+			strconv.FormatUint(uint64(t.ID), 10),
+			t.CreatedAt.In(invoiceZone).Format(time.RFC3339),
+			string(t.Type),
+			string(t.Status),
+			csvText(t.Description),
+			csvText(exportCounterparty(t, amount)),
+			exportAmount(amount),
+			currency,
+			fee,
+		})
+		if n++; n%exportBatchSize == 0 {
+			out.Flush()
+			w.Flush()
+		}
+		return out.Error()
+	})
+	out.Flush()
+	if err != nil {
+		return err
+	}
+	return out.Error()
+}
+
+func exportTransactionsOFX(w io.Writer, f txFilter, wallet *models.Wallet) error {
+	now := time.Now().UTC()
+	start, end := now, now
+	if f.From != nil {
+		start = *f.From
+	} else {
+		var first models.Transaction
+		if f.apply(config.DB.Model(&models.Transaction{})).Order("created_at").Limit(1).Find(&first); first.ID != 0 {
+			start = first.CreatedAt
+		}
+	}
+	if f.To != nil && f.To.Before(now) {
+		end = *f.To
+	}
+	ofx := ofxWriter{w: w}
+	ofx.header(wallet, start, end)
+	err := eachTx(f, func(t *models.Transaction) error {
+		amount, _ := f.userAmount(t)
+		ofx.transaction(t, amount)
+		return ofx.err
+	})
+	if err != nil {
+		return err
+	}
+	ofx.footer(wallet.Balance, now)
+	return ofx.err
+}
+
+func exportTransactionsPDF(w gin.ResponseWriter, f txFilter, user *models.User) error {
+	doc := pdf.New(w, "Transações")
+	doc.Text(pdf.HelveticaBold, 14, "Transações - "+displayName(user))
+	doc.Text(pdf.Helvetica, 9, "Período: "+exportPeriod(f.From, f.To))
+	doc.Rule()
+	doc.Text(pdf.Courier, 8, exportPDFRow("Data", "Tipo", "Descrição", "Contraparte", "Valor"))
+	credits, debits := make(map[string]int64), make(map[string]int64)
+	n := 0
+	err := eachTx(f, func(t *models.Transaction) error {
+		amount, currency := f.userAmount(t)
+		if amount < 0 {
+			debits[currency] -= toCents(amount)
+		} else {
+			credits[currency] += toCents(amount)
+		}
+		doc.Text(pdf.Courier, 8, exportPDFRow(
+			t.CreatedAt.In(invoiceZone).Format("02/01/2006 15:04"),
+			string(t.Type),
+			t.Description,
+			exportCounterparty(t, amount),
+			formatMoney(amount, currency),
+		))
+		if n++; n%exportBatchSize == 0 {
+			w.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	doc.Rule()
+	doc.Text(pdf.Helvetica, 9, fmt.Sprintf("%d transações", n))
+	for _, currency := range sortedCurrencies(credits, debits) {
+		doc.Text(pdf.Helvetica, 9, fmt.Sprintf("%s: entradas %s, saídas %s", currency,
+			formatMoney(fromCents(credits[currency]), currency), formatMoney(fromCents(debits[currency]), currency)))
+	}
+	return doc.Close()
+}
+
+// exportPDFRow lines up a transaction in Courier 8, which fits 107 characters across A4.
+func exportPDFRow(date, kind, description, counterparty, amount string) string {
+	return strings.Join([]string{
+		pdf.Column(date, 16),
+		pdf.Column(kind, 10),
+		pdf.Column(description, 32),
+		pdf.Column(counterparty, 24),
+		pdf.RightColumn(amount, 18),
+	}, " ")
+}
+
+func exportPeriod(from, to *time.Time) string {
+	start, end := "início", "hoje"
+	if from != nil {
+		start = from.In(invoiceZone).Format("02/01/2006 15:04")
+	}
+	if to != nil {
+		end = to.In(invoiceZone).Format("02/01/2006 15:04")
+	}
+	return start + " a " + end
+}
+
+func sortedCurrencies(maps ...map[string]int64) []string {
+	seen := make(map[string]bool)
+	var currencies []string
+	for _, m := range maps {
+		for currency := range m {
+			if !seen[currency] {
+				seen[currency] = true
+				currencies = append(currencies, currency)
+			}
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// ExportStatement downloads the statement GetStatement returns as CSV, OFX or PDF.
+func ExportStatement(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	statement, wallet, closed, ok := loadStatement(c)
+	if !ok {
+		return
+	}
+	var user models.User
+	config.DB.First(&user, c.GetUint("user_id"))
+	name := fmt.Sprintf("extrato-%d-%s", wallet.ID, statement.PeriodStart.In(invoiceZone).Format("20060102"))
+	startExport(c, format, name)
+	var err error
+	switch format {
+	case exportCSV:
+		err = exportStatementCSV(c.Writer, statement)
+	case exportOFX:
+		ofx := ofxWriter{w: c.Writer}
+		ofx.header(wallet, statement.PeriodStart, statement.PeriodEnd)
+		for i := range statement.Lines {
+			l := &statement.Lines[i]
+			ofx.line(l.TransactionID, l.PostedAt, l.Amount, l.Description, l.Counterparty)
+		}
+		ofx.footer(statement.ClosingBalance, statement.PeriodEnd)
+		err = ofx.err
+	case exportPDF:
+		err = exportStatementPDF(c.Writer, statement, wallet, &user, closed)
+	}
+	if err != nil {
+		fmt.Printf("Failed to export statement of wallet %d: %v\n", wallet.ID, err)
+		c.Abort()
+	}
+}
+
+func exportStatementCSV(w io.Writer, s *models.Statement) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"transaction_id", "date", "type", "description", "counterparty", "amount", "balance", "currency"})
+	out.Write([]string{"", s.PeriodStart.In(invoiceZone).Format(time.RFC3339), "", "Saldo inicial", "", "", exportAmount(s.OpeningBalance), s.Currency})
+	for _, l := range s.Lines {
+		out.Write([]string{
+			strconv.FormatUint(uint64(l.TransactionID), 10),
+			l.PostedAt.In(invoiceZone).Format(time.RFC3339),
+			string(l.Type),
+			csvText(l.Description),
+			csvText(l.Counterparty),
+			exportAmount(l.Amount),
+			exportAmount(l.Balance),
+			s.Currency,
+		})
+	}
+	out.Write([]string{"", s.PeriodEnd.In(invoiceZone).Format(time.RFC3339), "", "Saldo final", "", "", exportAmount(s.ClosingBalance), s.Currency})
+	out.Flush()
+	return out.Error()
+}
+
+func exportStatementPDF(w io.Writer, s *models.Statement, wallet *models.Wallet, user *models.User, closed bool) error {
+	doc := pdf.New(w, "Extrato")
+	doc.Text(pdf.HelveticaBold, 14, "Extrato - "+displayName(user))
+	doc.Text(pdf.Helvetica, 9, fmt.Sprintf("Carteira: %s (%s)", wallet.Name, s.Currency))
+	doc.Text(pdf.Helvetica, 9, "Período: "+exportPeriod(&s.PeriodStart, &s.PeriodEnd))
+	if closed {
+		doc.Text(pdf.Helvetica, 9, "Fechado em "+s.ClosedAt.In(invoiceZone).Format("02/01/2006 15:04"))
+	}
+	doc.Rule()
+	doc.Text(pdf.Courier, 8, statementPDFRow("Data", "Descrição", "Contraparte", "Valor", "Saldo"))
+	doc.Text(pdf.Courier, 8, statementPDFRow("", "Saldo inicial", "", "", formatMoney(s.OpeningBalance, s.Currency)))
+	for _, l := range s.Lines {
+		description := l.Description
+		if description == "" {
+			description = string(l.Type)
+		}
+		doc.Text(pdf.Courier, 8, statementPDFRow(
+			l.PostedAt.In(invoiceZone).Format("02/01/2006 15:04"),
+			description,
+			l.Counterparty,
+			formatMoney(l.Amount, s.Currency),
+			formatMoney(l.Balance, s.Currency),
+		))
+	}
+	doc.Text(pdf.Courier, 8, statementPDFRow("", "Saldo final", "", "", formatMoney(s.ClosingBalance, s.Currency)))
+	doc.Rule()
+	doc.Text(pdf.Helvetica, 9, fmt.Sprintf("Entradas: %s   Saídas: %s",
+		formatMoney(s.TotalCredits, s.Currency), formatMoney(s.TotalDebits, s.Currency)))
+	return doc.Close()
+}
+
+func statementPDFRow(date, description, counterparty, amount, balance string) string {
+	return strings.Join([]string{
+		pdf.Column(date, 16),
+		pdf.Column(description, 30),
+		pdf.Column(counterparty, 22),
+		pdf.RightColumn(amount, 16),
+		pdf.RightColumn(balance, 16),
+	}, " ")
+}
+
+// ofxWriter writes OFX 1.02 (SGML), the version Brazilian banks export and most accounting
+// software imports.
+type ofxWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (o *ofxWriter) printf(format string, args ...interface{}) {
+	if o.err == nil {
+		_, o.err = fmt.Fprintf(o.w, format, args...)
+	}
+}
+
+func ofxDate(t time.Time) string {
+	return t.In(invoiceZone).Format("20060102150405") + "[-3:BRT]"
+}
+
+func ofxText(s string) string {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ").Replace(s)
+	if r := []rune(s); len(r) > 255 {
+		s = string(r[:255])
+	}
+	return s
+}
+
+func (o *ofxWriter) header(wallet *models.Wallet, start, end time.Time) {
+	now := time.Now()
+	o.printf("OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:UTF-8\r\nCHARSET:NONE\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	o.printf("<OFX>\r\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>%s<LANGUAGE>POR</SONRS></SIGNONMSGSRSV1>\r\n", ofxDate(now))
+	o.printf("<BANKMSGSRSV1><STMTTRNRS><TRNUID>%d<STATUS><CODE>0<SEVERITY>INFO</STATUS><STMTRS>\r\n", now.Unix())
+	o.printf("<CURDEF>%s<BANKACCTFROM><BANKID>PAGCORE<ACCTID>%d-%d<ACCTTYPE>CHECKING</BANKACCTFROM>\r\n", wallet.Currency, wallet.UserID, wallet.ID)
+	o.printf("<BANKTRANLIST><DTSTART>%s<DTEND>%s\r\n", ofxDate(start), ofxDate(end))
+}
+
+func (o *ofxWriter) transaction(t *models.Transaction, amount float64) {
+	o.line(t.ID, t.CreatedAt, amount, t.Description, exportCounterparty(t, amount))
+}
+
+func (o *ofxWriter) line(id uint, posted time.Time, amount float64, memo, name string) {
+	kind := "CREDIT"
+	if amount < 0 {
+		kind = "DEBIT"
+	}
+	o.printf("<STMTTRN><TRNTYPE>%s<DTPOSTED>%s<TRNAMT>%s<FITID>%d", kind, ofxDate(posted), exportAmount(amount), id)
+	if name != "" {
+		if r := []rune(name); len(r) > 32 {
+			name = string(r[:32])
+		}
+		o.printf("<NAME>%s", ofxText(name))
+	}
+	if memo != "" {
+		o.printf("<MEMO>%s", ofxText(memo))
+	}
+	o.printf("</STMTTRN>\r\n")
+}
+
+func (o *ofxWriter) footer(balance float64, asOf time.Time) {
+	o.printf("</BANKTRANLIST><LEDGERBAL><BALAMT>%s<DTASOF>%s</LEDGERBAL>\r\n", exportAmount(balance), ofxDate(asOf))
+	o.printf("</STMTRS></STMTTRNRS></BANKMSGSRSV1>\r\n</OFX>\r\n")
+}
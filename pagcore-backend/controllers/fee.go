@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// findFeeSchedule returns the active schedule for the movement, preferring one specific to the
+// user's tier over the catch-all one. A nil schedule means the movement is free.
+func findFeeSchedule(tx *gorm.DB, feeType models.FeeTransactionType, tier models.UserTier, currency string) (*models.FeeSchedule, error) {
+	var schedules []models.FeeSchedule
+	err := tx.Preload("Tiers").
+		Where("transaction_type = ? AND currency = ? AND active = ? AND (user_tier = ? OR user_tier = '')", feeType, currency, true, tier).
+		Order("user_tier desc, id desc").Find(&schedules).Error
+	if err != nil || len(schedules) == 0 {
+		return nil, err
+	}
+	return &schedules[0], nil
+}
+
+// computeFee applies a schedule to an amount, rounding to the cent.
+func computeFee(s *models.FeeSchedule, amount float64) float64 {
+	if s == nil {
+		return 0
+	}
+	var fee float64
+	switch s.Kind {
+	case models.FeeKindFlat:
+		fee = s.FlatAmount
+	case models.FeeKindPercentage:
+		fee = s.FlatAmount + amount*s.Percentage/100
+	case models.FeeKindTiered:
+		tiers := append([]models.FeeTier(nil), s.Tiers...)
+		sort.Slice(tiers, func(i, j int) bool {
+			if tiers[i].UpTo == nil || tiers[j].UpTo == nil {
+				return tiers[j].UpTo == nil && tiers[i].UpTo != nil
+			}
+			return *tiers[i].UpTo < *tiers[j].UpTo
+		})
+		for _, t := range tiers {
+			if t.UpTo == nil || amount <= *t.UpTo {
+				fee = t.FlatAmount + amount*t.Percentage/100
+				break
+			}
+		}
+	}
+	if s.MinFee != nil && fee < *s.MinFee {
+		fee = *s.MinFee
+	}
+	if s.MaxFee != nil && fee > *s.MaxFee {
+		fee = *s.MaxFee
+	}
+	return math.Round(fee*100) / 100
+}
+
+// quoteFee returns the fee a user would pay to move amount out of a wallet.
+func quoteFee(tx *gorm.DB, feeType models.FeeTransactionType, payer *models.User, wallet *models.Wallet, amount float64) (float64, error) {
+	schedule, err := findFeeSchedule(tx, feeType, payer.Tier, wallet.Currency)
+	if err != nil {
+		return 0, err
+	}
+	return computeFee(schedule, amount), nil
+}
+
+// platformRevenueWallet returns the platform wallet that collects fees in the given currency,
+// creating the platform account on first use. Concurrent first uses may both try to create it,
+// so the inserts skip conflicts and the rows are read back.
+func platformRevenueWallet(tx *gorm.DB, currency string) (models.Wallet, error) {
+	var platform models.User
+	err := tx.Where("username = ?", models.PlatformUsername).First(&platform).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.User{
+			FullName: "PagCore",
+			Email:    "receita@pagcore.local",
+			Username: models.PlatformUsername,
+			Password: "!", // Not a bcrypt hash, so nobody can log in
+			Status:   models.UserStatusBlocked,
+			Role:     models.UserRoleSystem,
+		}).Error
+		if err == nil {
+			err = tx.Where("username = ?", models.PlatformUsername).First(&platform).Error
+		}
+	}
+	if err != nil {
+		return models.Wallet{}, err
+	}
+	var wallet models.Wallet
+	err = tx.Where("user_id = ? AND currency = ?", platform.ID, currency).First(&wallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		name := "Receita " + currency
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Wallet{
+			UserID:    platform.ID,
+			Name:      name,
+			Currency:  currency,
+			IsDefault: currency == models.BaseCurrency,
+		}).Error
+		if err == nil {
+			err = tx.Where("user_id = ? AND name = ?", platform.ID, name).First(&wallet).Error
+		}
+	}
+	return wallet, err
+}
+
+// chargeFee posts the fee for an already recorded movement to the platform revenue wallet,
+// inside the same DB transaction as the movement itself.
+func chargeFee(tx *gorm.DB, feeType models.FeeTransactionType, payer *models.User, wallet *models.Wallet, parent *models.Transaction) error {
+	fee, err := quoteFee(tx, feeType, payer, wallet, parent.Amount)
+	if err != nil {
+		return err
+	}
+	return postFee(tx, payer, wallet, parent, fee)
+}
+
+// postFee moves an already computed fee to the platform revenue wallet.
+func postFee(tx *gorm.DB, payer *models.User, wallet *models.Wallet, parent *models.Transaction, fee float64) error {
+	if fee == 0 {
+		return nil
+	}
+	revenue, err := platformRevenueWallet(tx, wallet.Currency)
+	if err != nil {
+		return err
+	}
+	move := exchange{Debit: fee, Credit: fee}
+	if err := moveBalance(tx, wallet, &revenue, move); err != nil {
+		return err
+	}
+	parent.Fee = fee
+	if err := tx.Model(parent).Update("fee", fee).Error; err != nil {
+		return err
+	}
+	feeRecord := models.Transaction{
+		SenderID:    payer.ID,
+		RecipientID: revenue.UserID,
+		Description: fmt.Sprintf("Tarifa da transação #%d", parent.ID),
+		Type:        models.TransactionTypeFee,
+		FeeForID:    &parent.ID,
+	}
+	move.record(&feeRecord, wallet, &revenue)
+	return tx.Create(&feeRecord).Error
+}
+
+// GetFeeQuote shows the fee for a movement before the user confirms it.
+func GetFeeQuote(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	feeType := models.FeeTransactionType(c.Query("type"))
+	switch feeType {
+	case models.FeeTransactionTransfer, models.FeeTransactionQRPayment, models.FeeTransactionWithdrawal:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de transação inválido"})
+		return
+	}
+	amount, err := strconv.ParseFloat(c.Query("amount"), 64)
+	if err != nil || amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valor inválido"})
+		return
+	}
+	var walletID *uint
+	if id, err := strconv.ParseUint(c.Query("wallet_id"), 10, 32); err == nil {
+		wid := uint(id)
+		walletID = &wid
+	}
+	var user models.User
+	config.DB.First(&user, userID)
+	wallet, err := resolveWallet(config.DB, userID, walletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao calcular tarifa")
+		return
+	}
+	fee, err := quoteFee(config.DB, feeType, &user, &wallet, amount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao calcular tarifa"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"amount":   amount,
+		"fee":      fee,
+		"total":    fromCents(toCents(amount) + toCents(fee)),
+		"currency": wallet.Currency,
+	})
+}
+
+type FeeTierInput struct {
+	UpTo       *float64 `json:"up_to" binding:"omitempty,gt=0"`
+	FlatAmount float64  `json:"flat_amount" binding:"gte=0"`
+	Percentage float64  `json:"percentage" binding:"gte=0,lte=100"`
+}
+
+type FeeScheduleInput struct {
+	TransactionType models.FeeTransactionType `json:"transaction_type" binding:"required,oneof=transfer qr_payment withdrawal"`
+	UserTier        models.UserTier           `json:"user_tier" binding:"omitempty,oneof=standard premium"`
+	Currency        string                    `json:"currency" binding:"omitempty,iso4217"`
+	Kind            models.FeeKind            `json:"kind" binding:"required,oneof=flat percentage tiered"`
+	FlatAmount      float64                   `json:"flat_amount" binding:"gte=0"`
+	Percentage      float64                   `json:"percentage" binding:"gte=0,lte=100"`
+	MinFee          *float64                  `json:"min_fee" binding:"omitempty,gte=0"`
+	MaxFee          *float64                  `json:"max_fee" binding:"omitempty,gte=0"`
+	Tiers           []FeeTierInput            `json:"tiers" binding:"dive"`
+	Active          *bool                     `json:"active"`
+}
+
+func (input FeeScheduleInput) toSchedule() (models.FeeSchedule, error) {
+	if input.Kind == models.FeeKindTiered && len(input.Tiers) == 0 {
+		return models.FeeSchedule{}, errors.New("Tarifas escalonadas precisam de faixas")
+	}
+	if input.MinFee != nil && input.MaxFee != nil && *input.MinFee > *input.MaxFee {
+		return models.FeeSchedule{}, errors.New("Tarifa mínima maior que a máxima")
+	}
+	schedule := models.FeeSchedule{
+		TransactionType: input.TransactionType,
+		UserTier:        input.UserTier,
+		Currency:        models.BaseCurrency,
+		Kind:            input.Kind,
+		FlatAmount:      input.FlatAmount,
+		Percentage:      input.Percentage,
+		MinFee:          input.MinFee,
+		MaxFee:          input.MaxFee,
+		Active:          input.Active == nil || *input.Active,
+	}
+	if input.Currency != "" {
+		schedule.Currency = input.Currency
+	}
+	for _, t := range input.Tiers {
+		schedule.Tiers = append(schedule.Tiers, models.FeeTier{UpTo: t.UpTo, FlatAmount: t.FlatAmount, Percentage: t.Percentage})
+	}
+	return schedule, nil
+}
+
+func GetFeeSchedules(c *gin.Context) {
+	var schedules []models.FeeSchedule
+	config.DB.Preload("Tiers").Order("transaction_type, user_tier, id").Find(&schedules)
+	c.JSON(http.StatusOK, schedules)
+}
+
+func CreateFeeSchedule(c *gin.Context) {
+	var input FeeScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := input.toSchedule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar tarifa"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func UpdateFeeSchedule(c *gin.Context) {
+	var existing models.FeeSchedule
+	if err := config.DB.First(&existing, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tarifa não encontrada"})
+		return
+	}
+	var input FeeScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := input.toSchedule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.ID = existing.ID
+	schedule.CreatedAt = existing.CreatedAt
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", existing.ID).Delete(&models.FeeTier{}).Error; err != nil {
+			return err
+		}
+		// Select("*") so zero values such as active=false are written too
+		if err := tx.Select("*").Omit("Tiers").Save(&schedule).Error; err != nil {
+			return err
+		}
+		for i := range schedule.Tiers {
+			schedule.Tiers[i].ScheduleID = schedule.ID
+			if err := tx.Create(&schedule.Tiers[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar tarifa"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func DeleteFeeSchedule(c *gin.Context) {
+	var schedule models.FeeSchedule
+	if err := config.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tarifa não encontrada"})
+		return
+	}
+	if err := config.DB.Select("Tiers").Delete(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover tarifa"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tarifa removida"})
+}
+
+type UserTierInput struct {
+	Tier models.UserTier `json:"tier" binding:"required,oneof=standard premium"`
+}
+
+func SetUserTier(c *gin.Context) {
+	var input UserTierInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	config.DB.Model(&user).Update("tier", input.Tier)
+	c.JSON(http.StatusOK, gin.H{"message": "Categoria atualizada"})
+}
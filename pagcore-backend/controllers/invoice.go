@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Due dates are calendar days in Brasília time, which has no daylight saving since 2019.
+var invoiceZone = time.FixedZone("BRT", -3*60*60)
+
+const invoiceDateLayout = "2006-01-02"
+
+type InvoiceItemInput struct {
+	Description string  `json:"description" binding:"required"`
+	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
+	UnitPrice   float64 `json:"unit_price" binding:"required,gt=0"`
+}
+
+type CreateInvoiceInput struct {
+	PayerUsername string             `json:"payer_username" binding:"required"`
+	Description   string             `json:"description"`
+	Items         []InvoiceItemInput `json:"items" binding:"required,min=1,dive"`
+	DueDate       string             `json:"due_date" binding:"required"`          // YYYY-MM-DD
+	EarlyDiscount float64            `json:"early_discount" binding:"gte=0"`       // Fixed amount
+	DiscountUntil string             `json:"discount_until"`                       // YYYY-MM-DD, defaults to the due date
+	DailyInterest float64            `json:"daily_interest" binding:"gte=0,lte=1"` // Percent of the principal per day
+	LateFee       float64            `json:"late_fee" binding:"gte=0"`             // Fixed amount
+	PayUntil      string             `json:"pay_until"`                            // YYYY-MM-DD, last day it can be paid
+	WalletID      *uint              `json:"wallet_id"`                            // Receiving wallet, defaults to the default wallet
+}
+
+// invoiceDate parses a calendar day. Dates are stored as midnight UTC of that day.
+func invoiceDate(s string) (time.Time, error) {
+	return time.Parse(invoiceDateLayout, s)
+}
+
+// invoiceToday is the current calendar day in Brasília, comparable with stored dates.
+func invoiceToday(now time.Time) time.Time {
+	local := now.In(invoiceZone)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// invoiceCharges breaks down what an invoice costs when paid on a given moment.
+type invoiceCharges struct {
+	Principal float64 `json:"principal"`
+	Discount  float64 `json:"discount"`
+	DaysLate  int     `json:"days_late"`
+	Interest  float64 `json:"interest"`
+	LateFee   float64 `json:"late_fee"`
+	Total     float64 `json:"total"`
+}
+
+func computeInvoiceCharges(inv *models.Invoice, principal float64, now time.Time) invoiceCharges {
+	today := invoiceToday(now)
+	due := inv.DueDate.UTC()
+	charges := invoiceCharges{Principal: principal}
+	principalCents := toCents(principal)
+	totalCents := principalCents
+	switch {
+	case inv.DiscountUntil != nil && !today.After(inv.DiscountUntil.UTC()):
+		charges.Discount = inv.EarlyDiscount
+		totalCents -= toCents(inv.EarlyDiscount)
+	case today.After(due):
+		charges.DaysLate = int(today.Sub(due).Hours() / 24)
+		interestCents := int64(math.Round(float64(principalCents) * inv.DailyInterest / 100 * float64(charges.DaysLate)))
+		charges.Interest = fromCents(interestCents)
+		charges.LateFee = inv.LateFee
+		totalCents += interestCents + toCents(inv.LateFee)
+	}
+	charges.Total = fromCents(totalCents)
+	return charges
+}
+
+func CreateInvoice(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input CreateInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	today := invoiceToday(time.Now())
+	dueDate, err := invoiceDate(input.DueDate)
+	if err != nil || dueDate.Before(today) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Data de vencimento inválida"})
+		return
+	}
+	invoice := models.Invoice{
+		DueDate:       dueDate,
+		DailyInterest: input.DailyInterest,
+		LateFee:       input.LateFee,
+	}
+	var subtotal int64
+	for _, item := range input.Items {
+		total := toCents(item.Quantity * item.UnitPrice)
+		subtotal += total
+		invoice.Items = append(invoice.Items, models.InvoiceItem{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Total:       fromCents(total),
+		})
+	}
+	if input.EarlyDiscount > 0 {
+		if toCents(input.EarlyDiscount) >= subtotal {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Desconto deve ser menor que o valor da fatura"})
+			return
+		}
+		discountUntil := dueDate
+		if input.DiscountUntil != "" {
+			if discountUntil, err = invoiceDate(input.DiscountUntil); err != nil || discountUntil.After(dueDate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "O desconto deve valer até o vencimento"})
+				return
+			}
+		}
+		invoice.EarlyDiscount = input.EarlyDiscount
+		invoice.DiscountUntil = &discountUntil
+	}
+	var payer models.User
+	config.DB.Where("username = ?", input.PayerUsername).First(&payer)
+	if payer.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pagador não encontrado"})
+		return
+	}
+	if payer.ID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Não pode emitir fatura para si mesmo"})
+		return
+	}
+	wallet, err := resolveWallet(config.DB, userID, input.WalletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao emitir fatura")
+		return
+	}
+	req := models.PaymentRequest{
+		RequesterID: userID,
+		PayerID:     payer.ID,
+		Amount:      fromCents(subtotal),
+		Currency:    wallet.Currency,
+		WalletID:    &wallet.ID,
+		Description: input.Description,
+	}
+	if input.PayUntil != "" {
+		payUntil, err := invoiceDate(input.PayUntil)
+		if err != nil || payUntil.Before(dueDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Data limite deve ser depois do vencimento"})
+			return
+		}
+		// Payable through the whole last day in Brasília
+		expiresAt := time.Date(payUntil.Year(), payUntil.Month(), payUntil.Day()+1, 0, 0, 0, 0, invoiceZone).UTC()
+		req.ExpiresAt = &expiresAt
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		invoice.PaymentRequestID = req.ID
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+		if err := outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestCreated, payer.ID, &req, &invoice)); err != nil {
+			return err
+		}
+		return notifyPaymentRequest(tx, models.NotificationPaymentRequestCreated, &req)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao emitir fatura"})
+		return
+	}
+	req.Invoice = &invoice
+	c.JSON(http.StatusOK, invoiceResponse(&req, time.Now()))
+}
+
+func invoiceResponse(req *models.PaymentRequest, now time.Time) gin.H {
+	inv := req.Invoice
+	response := gin.H{
+		"id":                 inv.ID,
+		"payment_request_id": req.ID,
+		"requester":          req.Requester.Username,
+		"requester_name":     displayName(&req.Requester),
+		"payer":              req.Payer.Username,
+		"description":        req.Description,
+		"currency":           req.Currency,
+		"items":              inv.Items,
+		"subtotal":           req.Amount,
+		"due_date":           inv.DueDate.Format(invoiceDateLayout),
+		"early_discount":     inv.EarlyDiscount,
+		"daily_interest":     inv.DailyInterest,
+		"late_fee":           inv.LateFee,
+		"status":             req.Status,
+		"pay_until":          formatExpiry(req.ExpiresAt),
+		"paid_at":            formatExpiry(inv.PaidAt),
+		"amount_charged":     inv.AmountCharged,
+		"pay_url":            "/api/payment/accept/" + strconv.FormatUint(uint64(req.ID), 10),
+	}
+	if inv.DiscountUntil != nil {
+		response["discount_until"] = inv.DiscountUntil.Format(invoiceDateLayout)
+	}
+	if paymentRequestOpen(req.Status) {
+		response["amount_due"] = computeInvoiceCharges(inv, req.Amount, now)
+	}
+	return response
+}
+
+func invoiceQuery() *gorm.DB {
+	return config.DB.Preload("Requester").Preload("Payer").Preload("Invoice.Items").
+		Joins("JOIN invoices ON invoices.payment_request_id = payment_requests.id")
+}
+
+// GetInvoices lists the invoices the user issued, newest first.
+func GetInvoices(c *gin.Context) {
+	var reqs []models.PaymentRequest
+	invoiceQuery().Where("payment_requests.requester_id = ?", c.GetUint("user_id")).
+		Order("payment_requests.created_at desc").Find(&reqs)
+	now := time.Now()
+	result := make([]gin.H, len(reqs))
+	for i := range reqs {
+		result[i] = invoiceResponse(&reqs[i], now)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPayableInvoices lists the open invoices addressed to the user by due date, with what
+// each costs today. They are paid through POST /payment/accept/:payment_request_id.
+func GetPayableInvoices(c *gin.Context) {
+	now := time.Now()
+	var reqs []models.PaymentRequest
+	invoiceQuery().Where("payment_requests.payer_id = ? AND payment_requests.status = ?", c.GetUint("user_id"), models.PaymentStatusPending).
+		Where("payment_requests.expires_at IS NULL OR payment_requests.expires_at > ?", now.UTC()).
+		Order("invoices.due_date").Find(&reqs)
+	result := make([]gin.H, len(reqs))
+	for i := range reqs {
+		result[i] = invoiceResponse(&reqs[i], now)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func GetInvoice(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req models.PaymentRequest
+	if err := invoiceQuery().Where("invoices.id = ?", c.Param("invoice_id")).First(&req).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fatura não encontrada"})
+		return
+	}
+	if req.RequesterID != userID && req.PayerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado"})
+		return
+	}
+	expirePaymentRequestIfStale(&req)
+	c.JSON(http.StatusOK, invoiceResponse(&req, time.Now()))
+}
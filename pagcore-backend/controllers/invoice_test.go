@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+)
+
+func TestComputeInvoiceCharges(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, err := invoiceDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+	// Moments in Brasília time, where the calendar day is decided
+	at := func(s string) time.Time {
+		m, err := time.ParseInLocation("2006-01-02 15:04", s, invoiceZone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	invoice := models.Invoice{
+		DueDate:       *date("2025-03-10"),
+		EarlyDiscount: 10,
+		DiscountUntil: date("2025-03-05"),
+		DailyInterest: 0.033,
+		LateFee:       2,
+	}
+	noDiscount := invoice
+	noDiscount.DiscountUntil = nil
+
+	tests := []struct {
+		name      string
+		invoice   models.Invoice
+		principal float64
+		now       time.Time
+		want      invoiceCharges
+	}{
+		{"early discount", invoice, 1000, at("2025-03-01 10:00"),
+			invoiceCharges{Principal: 1000, Discount: 10, Total: 990}},
+		{"discount through the last day, late evening in Brasília", invoice, 1000, at("2025-03-05 23:30"),
+			invoiceCharges{Principal: 1000, Discount: 10, Total: 990}},
+		{"after the discount, before due", invoice, 1000, at("2025-03-06 00:00"),
+			invoiceCharges{Principal: 1000, Total: 1000}},
+		{"on the due date", invoice, 1000, at("2025-03-10 23:59"),
+			invoiceCharges{Principal: 1000, Total: 1000}},
+		{"one day late", invoice, 1000, at("2025-03-11 00:01"),
+			invoiceCharges{Principal: 1000, DaysLate: 1, Interest: 0.33, LateFee: 2, Total: 1002.33}},
+		{"thirty days late", invoice, 1000, at("2025-04-09 12:00"),
+			invoiceCharges{Principal: 1000, DaysLate: 30, Interest: 9.90, LateFee: 2, Total: 1011.90}},
+		{"interest rounds to the cent", invoice, 99.99, at("2025-03-11 08:00"),
+			invoiceCharges{Principal: 99.99, DaysLate: 1, Interest: 0.03, LateFee: 2, Total: 102.02}},
+		{"no discount configured", noDiscount, 1000, at("2025-03-01 10:00"),
+			invoiceCharges{Principal: 1000, Total: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeInvoiceCharges(&tt.invoice, tt.principal, tt.now.UTC()); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errNoSettlementAccount = errors.New("merchant has no settlement account")
+	errLastOwner           = errors.New("merchant needs at least one owner")
+)
+
+// onlyDigits drops the punctuation of formatted documents such as "12.345.678/0001-95".
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// validCNPJ checks the length and both check digits of a CNPJ given as digits.
+func validCNPJ(cnpj string) bool {
+	if len(cnpj) != 14 || strings.Count(cnpj, cnpj[:1]) == 14 {
+		return false
+	}
+	checkDigit := func(n int) byte {
+		weight, sum := n-7, 0
+		for i := 0; i < n; i++ {
+			sum += int(cnpj[i]-'0') * weight
+			if weight--; weight < 2 {
+				weight = 9
+			}
+		}
+		if r := sum % 11; r >= 2 {
+			return byte('0' + 11 - r)
+		}
+		return '0'
+	}
+	return cnpj[12] == checkDigit(12) && cnpj[13] == checkDigit(13)
+}
+
+func validMCC(mcc string) bool {
+	return len(mcc) == 4 && onlyDigits(mcc) == mcc
+}
+
+// displayName is the name payers see for a recipient: the trade name for merchants.
+func displayName(user *models.User) string {
+	if user.AccountType != models.AccountTypeMerchant {
+		return user.FullName
+	}
+	var profile models.MerchantProfile
+	if config.DB.Where("user_id = ?", user.ID).Limit(1).Find(&profile); profile.TradeName != "" {
+		return profile.TradeName
+	}
+	return user.FullName
+}
+
+type CreateMerchantInput struct {
+	CNPJ               string                    `json:"cnpj" binding:"required"`
+	LegalName          string                    `json:"legal_name" binding:"required"`
+	TradeName          string                    `json:"trade_name" binding:"required,max=60"`
+	MCC                string                    `json:"mcc" binding:"required"`
+	Username           string                    `json:"username" binding:"required"` // Key payers use to find the merchant
+	Email              string                    `json:"email" binding:"required,email"`
+	SettlementSchedule models.SettlementSchedule `json:"settlement_schedule" binding:"omitempty,oneof=manual daily weekly"`
+}
+
+// CreateMerchant opens a merchant account owned by the current user, who also receives its
+// settlements until another owner is chosen.
+func CreateMerchant(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input CreateMerchantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cnpj := onlyDigits(input.CNPJ)
+	if !validCNPJ(cnpj) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CNPJ inválido"})
+		return
+	}
+	if !validMCC(input.MCC) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MCC inválido"})
+		return
+	}
+	var creator models.User
+	if err := config.DB.First(&creator, userID).Error; err != nil || creator.AccountType == models.AccountTypeMerchant {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Apenas contas pessoais podem abrir estabelecimentos"})
+		return
+	}
+	schedule := input.SettlementSchedule
+	if schedule == "" {
+		schedule = models.SettlementScheduleManual
+	}
+	account := models.User{
+		FullName:    input.LegalName,
+		Email:       input.Email,
+		Username:    input.Username,
+		Password:    "!", // Not a bcrypt hash, staff sign in with their own accounts
+		AccountType: models.AccountTypeMerchant,
+	}
+	profile := models.MerchantProfile{
+		CNPJ:               cnpj,
+		LegalName:          input.LegalName,
+		TradeName:          input.TradeName,
+		MCC:                input.MCC,
+		SettlementSchedule: schedule,
+		SettlementUserID:   &userID,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		wallet := models.Wallet{UserID: account.ID, Name: models.DefaultWalletName, Currency: models.BaseCurrency, IsDefault: true}
+		if err := tx.Create(&wallet).Error; err != nil {
+			return err
+		}
+		profile.UserID = account.ID
+		if err := tx.Create(&profile).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.MerchantStaff{MerchantID: account.ID, UserID: userID, Role: models.MerchantStaffRoleOwner}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CNPJ, usuário ou email já cadastrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar estabelecimento"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Estabelecimento criado", "id": account.ID})
+}
+
+func merchantResponse(profile *models.MerchantProfile, role string) gin.H {
+	return gin.H{
+		"id":                  profile.UserID,
+		"username":            profile.User.Username,
+		"cnpj":                profile.CNPJ,
+		"legal_name":          profile.LegalName,
+		"trade_name":          profile.TradeName,
+		"mcc":                 profile.MCC,
+		"balance":             profile.User.Balance,
+		"settlement_schedule": profile.SettlementSchedule,
+		"settlement_user_id":  profile.SettlementUserID,
+		"last_settled_at":     profile.LastSettledAt,
+		"role":                role,
+	}
+}
+
+// GetMyMerchants lists the merchant accounts the user works for.
+func GetMyMerchants(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var staff []models.MerchantStaff
+	config.DB.Where("user_id = ?", userID).Find(&staff)
+	result := []gin.H{}
+	for _, s := range staff {
+		var profile models.MerchantProfile
+		if err := config.DB.Preload("User").Where("user_id = ?", s.MerchantID).First(&profile).Error; err != nil {
+			continue
+		}
+		result = append(result, merchantResponse(&profile, string(s.Role)))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// The handlers below run behind MerchantMiddleware, so user_id is the merchant account.
+
+func GetMerchant(c *gin.Context) {
+	var profile models.MerchantProfile
+	if err := config.DB.Preload("User").Where("user_id = ?", c.GetUint("user_id")).First(&profile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Estabelecimento não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, merchantResponse(&profile, c.GetString("merchant_role")))
+}
+
+type UpdateMerchantInput struct {
+	TradeName          *string                    `json:"trade_name" binding:"omitempty,min=1,max=60"`
+	MCC                *string                    `json:"mcc"`
+	SettlementSchedule *models.SettlementSchedule `json:"settlement_schedule" binding:"omitempty,oneof=manual daily weekly"`
+	SettlementUserID   *uint                      `json:"settlement_user_id"` // Must be an owner
+}
+
+func UpdateMerchant(c *gin.Context) {
+	merchantID := c.GetUint("user_id")
+	var input UpdateMerchantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updates := map[string]interface{}{"updated_at": time.Now().UTC()}
+	if input.TradeName != nil {
+		updates["trade_name"] = *input.TradeName
+	}
+	if input.MCC != nil {
+		if !validMCC(*input.MCC) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "MCC inválido"})
+			return
+		}
+		updates["mcc"] = *input.MCC
+	}
+	if input.SettlementSchedule != nil {
+		updates["settlement_schedule"] = *input.SettlementSchedule
+	}
+	if input.SettlementUserID != nil {
+		var count int64
+		config.DB.Model(&models.MerchantStaff{}).
+			Where("merchant_id = ? AND user_id = ? AND role = ?", merchantID, *input.SettlementUserID, models.MerchantStaffRoleOwner).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A conta de liquidação deve ser de um responsável"})
+			return
+		}
+		updates["settlement_user_id"] = *input.SettlementUserID
+	}
+	if err := config.DB.Model(&models.MerchantProfile{}).Where("user_id = ?", merchantID).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar estabelecimento"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Estabelecimento atualizado"})
+}
+
+func GetMerchantStaff(c *gin.Context) {
+	var staff []models.MerchantStaff
+	config.DB.Preload("User").Where("merchant_id = ?", c.GetUint("user_id")).Order("created_at").Find(&staff)
+	result := make([]gin.H, len(staff))
+	for i, s := range staff {
+		result[i] = gin.H{
+			"user_id":   s.UserID,
+			"username":  s.User.Username,
+			"full_name": s.User.FullName,
+			"role":      s.Role,
+			"since":     s.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type SetMerchantStaffInput struct {
+	Username string                   `json:"username" binding:"required"`
+	Role     models.MerchantStaffRole `json:"role" binding:"required,oneof=owner operator"`
+}
+
+// ensureOwnerRemains keeps a merchant from losing its last owner or its settlement account.
+func ensureOwnerRemains(tx *gorm.DB, merchantID, userID uint) error {
+	var profile models.MerchantProfile
+	if err := tx.Where("user_id = ?", merchantID).First(&profile).Error; err != nil {
+		return err
+	}
+	if profile.SettlementUserID != nil && *profile.SettlementUserID == userID {
+		return errNoSettlementAccount
+	}
+	var owners int64
+	if err := tx.Model(&models.MerchantStaff{}).
+		Where("merchant_id = ? AND role = ? AND user_id <> ?", merchantID, models.MerchantStaffRoleOwner, userID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func staffErrorResponse(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, errNoSettlementAccount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Altere a conta de liquidação antes de remover esse responsável"})
+	case errors.Is(err, errLastOwner):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "O estabelecimento precisa de pelo menos um responsável"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// SetMerchantStaff adds a staff member or changes their role.
+func SetMerchantStaff(c *gin.Context) {
+	merchantID := c.GetUint("user_id")
+	var input SetMerchantStaffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var member models.User
+	if err := config.DB.Where("username = ? AND account_type = ?", input.Username, models.AccountTypePersonal).First(&member).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var staff models.MerchantStaff
+		err := tx.Where("merchant_id = ? AND user_id = ?", merchantID, member.ID).First(&staff).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.MerchantStaff{MerchantID: merchantID, UserID: member.ID, Role: input.Role}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if staff.Role == models.MerchantStaffRoleOwner && input.Role != models.MerchantStaffRoleOwner {
+			if err := ensureOwnerRemains(tx, merchantID, member.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&staff).Update("role", input.Role).Error
+	})
+	if err != nil {
+		staffErrorResponse(c, err, "Falha ao atualizar equipe")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Equipe atualizada"})
+}
+
+func RemoveMerchantStaff(c *gin.Context) {
+	merchantID := c.GetUint("user_id")
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário inválido"})
+		return
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var staff models.MerchantStaff
+		if err := tx.Where("merchant_id = ? AND user_id = ?", merchantID, memberID).First(&staff).Error; err != nil {
+			return err
+		}
+		if staff.Role == models.MerchantStaffRoleOwner {
+			if err := ensureOwnerRemains(tx, merchantID, staff.UserID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&staff).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Membro da equipe não encontrado"})
+		return
+	}
+	if err != nil {
+		staffErrorResponse(c, err, "Falha ao remover membro da equipe")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Membro da equipe removido"})
+}
+
+// settleMerchant pays the balance of the merchant's default wallet out to the settlement
+// account and returns the settlement, nil when there was nothing to pay out.
+func settleMerchant(tx *gorm.DB, profile *models.MerchantProfile) (*models.Transaction, error) {
+	if profile.SettlementUserID == nil {
+		return nil, errNoSettlementAccount
+	}
+	from, err := defaultWallet(tx, profile.UserID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := defaultWallet(tx, *profile.SettlementUserID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := tx.Model(profile).Update("last_settled_at", now).Error; err != nil {
+		return nil, err
+	}
+	if from.Balance <= 0 {
+		return nil, nil
+	}
+	move, err := priceDebit(&from, &to, from.Balance)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveBalance(tx, &from, &to, move); err != nil {
+		return nil, err
+	}
+	txRecord := models.Transaction{
+		SenderID:    profile.UserID,
+		RecipientID: *profile.SettlementUserID,
+		Description: "Liquidação " + profile.TradeName,
+		Type:        models.TransactionTypeSettlement,
+	}
+	move.record(&txRecord, &from, &to)
+	if err := tx.Create(&txRecord).Error; err != nil {
+		return nil, err
+	}
+	return &txRecord, nil
+}
+
+// SettleMerchant lets an owner settle the merchant balance right away.
+func SettleMerchant(c *gin.Context) {
+	var settlement *models.Transaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var profile models.MerchantProfile
+		if err := tx.Where("user_id = ?", c.GetUint("user_id")).First(&profile).Error; err != nil {
+			return err
+		}
+		var err error
+		settlement, err = settleMerchant(tx, &profile)
+		return err
+	})
+	if err != nil {
+		walletErrorResponse(c, err, "Falha na liquidação")
+		return
+	}
+	if settlement == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Liquidação efetuada", "amount": 0})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Liquidação efetuada", "amount": settlement.Amount, "transaction_id": settlement.ID})
+}
+
+// SettleDueMerchants settles merchants on a daily or weekly schedule whose period has passed.
+// It runs as a background job with its own transactions, one per merchant, so a merchant that
+// fails is logged and skipped without undoing the others. It returns how many were settled.
+func SettleDueMerchants(db *gorm.DB) (int64, error) {
+	now := time.Now().UTC()
+	var due []models.MerchantProfile
+	err := db.Where("settlement_user_id IS NOT NULL").
+		Where("(settlement_schedule = ? AND (last_settled_at IS NULL OR last_settled_at <= ?)) OR (settlement_schedule = ? AND (last_settled_at IS NULL OR last_settled_at <= ?))",
+			models.SettlementScheduleDaily, now.Add(-24*time.Hour), models.SettlementScheduleWeekly, now.Add(-7*24*time.Hour)).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+	var settled int64
+	var firstErr error
+	for i := range due {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := settleMerchant(tx, &due[i])
+			return err
+		})
+		if err != nil {
+			fmt.Printf("Failed to settle merchant %d: %v\n", due[i].UserID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		settled++
+	}
+	return settled, firstErr
+}
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/mailer"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	notificationPageSize     = 20
+	notificationMaxPageSize  = 100
+	notificationEmailBatch   = 50
+	notificationEmailRetries = 5
+)
+
+// notificationTypes lists every type with whether it goes to email when the user has no preference.
+var notificationTypes = []struct {
+	Type  models.NotificationType
+	Email bool
+}{
+	{models.NotificationTransferReceived, false},
+	{models.NotificationQRPaid, false},
+	{models.NotificationPaymentLinkPaid, false},
+	{models.NotificationPaymentRequestCreated, true},
+	{models.NotificationPaymentRequestPaid, false},
+	{models.NotificationPaymentRequestDeclined, false},
+	{models.NotificationPaymentRequestCancelled, false},
+	{models.NotificationPaymentRequestReminder, true},
+	{models.NotificationNewDevice, true},
+}
+
+var currencySymbols = map[string]string{"BRL": "R$", "USD": "US$", "EUR": "€"}
+
+// formatMoney writes amounts the Brazilian way, e.g. "R$ 1.234,50".
+func formatMoney(amount float64, currency string) string {
+	cents := toCents(amount)
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	units := strconv.FormatInt(cents/100, 10)
+	var grouped []string
+	for len(units) > 3 {
+		grouped = append([]string{units[len(units)-3:]}, grouped...)
+		units = units[:len(units)-3]
+	}
+	grouped = append([]string{units}, grouped...)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	return fmt.Sprintf("%s%s %s,%02d", sign, symbol, strings.Join(grouped, "."), cents%100)
+}
+
+func wantsEmail(tx *gorm.DB, userID uint, kind models.NotificationType) bool {
+	var pref models.NotificationPreference
+	if tx.Where("user_id = ? AND type = ?", userID, kind).Limit(1).Find(&pref).RowsAffected > 0 {
+		return pref.Email
+	}
+	for _, t := range notificationTypes {
+		if t.Type == kind {
+			return t.Email
+		}
+	}
+	return false
+}
+
+// notifyUser adds a notification to the user's inbox inside tx, so it only exists if the
+// change it talks about commits. Emails go out later through SendNotificationEmails.
+func notifyUser(tx *gorm.DB, userID uint, kind models.NotificationType, title, body string, data gin.H) error {
+	n := models.Notification{
+		UserID:       userID,
+		Type:         kind,
+		Title:        title,
+		Body:         body,
+		EmailPending: wantsEmail(tx, userID, kind),
+	}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		n.Data = string(encoded)
+	}
+	if err := tx.Create(&n).Error; err != nil {
+		return err
+	}
+	return outbox.Publish(tx, outbox.Event{
+		Type:        outbox.EventNotificationCreated,
+		UserID:      userID,
+		Aggregate:   outbox.AggregateUser,
+		AggregateID: userID,
+		Data:        notificationResponse(&n),
+	})
+}
+
+// notifyTransferReceived tells the recipient that money arrived, in the recipient's currency.
+func notifyTransferReceived(tx *gorm.DB, kind models.NotificationType, recipientID uint, t *models.Transaction, sender *models.User) error {
+	amount, currency := t.Amount, t.Currency
+	if t.ConvertedAmount != nil {
+		amount, currency = *t.ConvertedAmount, t.ConvertedCurrency
+	}
+	title := "Você recebeu " + formatMoney(amount, currency)
+	switch kind {
+	case models.NotificationQRPaid:
+		title = "QR Code pago: " + formatMoney(amount, currency)
+	case models.NotificationPaymentLinkPaid:
+		title = "Link de pagamento pago: " + formatMoney(amount, currency)
+	case models.NotificationPaymentRequestPaid:
+		title = "Solicitação paga: " + formatMoney(amount, currency)
+	}
+	body := fmt.Sprintf("%s enviou %s para você.", displayName(sender), formatMoney(amount, currency))
+	if t.Description != "" {
+		body += " " + t.Description
+	}
+	return notifyUser(tx, recipientID, kind, title, body, gin.H{"transaction_id": t.ID})
+}
+
+// recordLoginDevice remembers the device of a login and warns the user when it is new. The very
+// first login doesn't warn, every device is new then.
+func recordLoginDevice(tx *gorm.DB, user *models.User, userAgent, ip string) error {
+	sum := sha256.Sum256([]byte(userAgent))
+	fingerprint := hex.EncodeToString(sum[:])
+	now := time.Now().UTC()
+	var device models.UserDevice
+	if tx.Where("user_id = ? AND fingerprint = ?", user.ID, fingerprint).Limit(1).Find(&device).RowsAffected > 0 {
+		return tx.Model(&device).Updates(map[string]interface{}{"last_ip": ip, "last_seen_at": now}).Error
+	}
+	var known int64
+	if err := tx.Model(&models.UserDevice{}).Where("user_id = ?", user.ID).Count(&known).Error; err != nil {
+		return err
+	}
+	device = models.UserDevice{UserID: user.ID, Fingerprint: fingerprint, UserAgent: userAgent, LastIP: ip, LastSeenAt: now}
+	if err := tx.Create(&device).Error; err != nil {
+		return err
+	}
+	if known == 0 {
+		return nil
+	}
+	body := fmt.Sprintf("Novo acesso à sua conta em %s a partir de %s (%s). Se não foi você, altere sua senha.",
+		now.In(invoiceZone).Format("02/01/2006 15:04"), ip, userAgent)
+	return notifyUser(tx, user.ID, models.NotificationNewDevice, "Acesso de um novo dispositivo", body, gin.H{"device_id": device.ID})
+}
+
+func notificationResponse(n *models.Notification) gin.H {
+	var data interface{}
+	if n.Data != "" {
+		data = json.RawMessage(n.Data)
+	}
+	return gin.H{
+		"id":         n.ID,
+		"type":       n.Type,
+		"title":      n.Title,
+		"body":       n.Body,
+		"data":       data,
+		"read":       n.ReadAt != nil,
+		"read_at":    n.ReadAt,
+		"created_at": n.CreatedAt,
+	}
+}
+
+// GetNotifications pages through the inbox, newest first. unread=true keeps only unread ones.
+func GetNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(notificationPageSize)))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > notificationMaxPageSize {
+		pageSize = notificationPageSize
+	}
+	query := config.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	var total, unread int64
+	query.Count(&total)
+	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+	var notifications []models.Notification
+	query.Order("created_at desc, id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&notifications)
+	items := make([]gin.H, len(notifications))
+	for i := range notifications {
+		items[i] = notificationResponse(&notifications[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":     items,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+		"unread":    unread,
+	})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	result := config.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Param("id"), c.GetUint("user_id")).
+		Update("read_at", time.Now().UTC())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao marcar como lida"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		config.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notificação não encontrada"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notificação lida"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	result := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", c.GetUint("user_id")).
+		Update("read_at", time.Now().UTC())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao marcar como lidas"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notificações lidas", "updated": result.RowsAffected})
+}
+
+// GetNotificationPreferences tells, for every notification type, whether it also goes by email.
+func GetNotificationPreferences(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	prefs := make(gin.H, len(notificationTypes))
+	for _, t := range notificationTypes {
+		prefs[string(t.Type)] = wantsEmail(config.DB, userID, t.Type)
+	}
+	c.JSON(http.StatusOK, gin.H{"email": prefs})
+}
+
+type NotificationPreferencesInput struct {
+	Email map[models.NotificationType]bool `json:"email" binding:"required"` // Type to whether it goes by email
+}
+
+func UpdateNotificationPreferences(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input NotificationPreferencesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	valid := make(map[models.NotificationType]bool)
+	for _, t := range notificationTypes {
+		valid[t.Type] = true
+	}
+	for kind := range input.Email {
+		if !valid[kind] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de notificação inválido: " + string(kind)})
+			return
+		}
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for kind, email := range input.Email {
+			var pref models.NotificationPreference
+			tx.Where("user_id = ? AND type = ?", userID, kind).Limit(1).Find(&pref)
+			pref.UserID, pref.Type, pref.Email = userID, kind, email
+			if err := tx.Save(&pref).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao salvar preferências"})
+		return
+	}
+	GetNotificationPreferences(c)
+}
+
+// SendNotificationEmails emails the notifications users opted in to, giving up on one after a
+// few failed attempts. It runs as a background job with its own transactions, so no transaction
+// stays open while the mail server answers, and returns how many were sent. A notification that
+// fails counts an attempt and the others still go out.
+func SendNotificationEmails(db *gorm.DB) (int64, error) {
+	var pending []models.Notification
+	if err := db.Where("email_pending = ?", true).Order("id").Limit(notificationEmailBatch).Find(&pending).Error; err != nil {
+		return 0, err
+	}
+	var sent int64
+	for i := range pending {
+		n := &pending[i]
+		updates := map[string]interface{}{"email_attempts": n.EmailAttempts + 1}
+		if err := emailNotification(db, n); err != nil {
+			fmt.Printf("Failed to email notification %d: %v\n", n.ID, err)
+			if n.EmailAttempts+1 >= notificationEmailRetries {
+				updates["email_pending"] = false
+			}
+		} else {
+			updates["email_pending"] = false
+			updates["emailed_at"] = time.Now().UTC()
+			sent++
+		}
+		if err := db.Model(n).Updates(updates).Error; err != nil {
+			fmt.Printf("Failed to record email of notification %d: %v\n", n.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+func emailNotification(db *gorm.DB, n *models.Notification) error {
+	var user models.User
+	if err := db.First(&user, n.UserID).Error; err != nil {
+		return err
+	}
+	return mailer.Send(user.Email, n.Title, n.Body)
+}
+
+// notifyPaymentRequest tells one side of a payment request what the other side did with it.
+func notifyPaymentRequest(tx *gorm.DB, kind models.NotificationType, req *models.PaymentRequest) error {
+	recipientID, actorID := req.PayerID, req.RequesterID
+	if kind == models.NotificationPaymentRequestDeclined {
+		recipientID, actorID = req.RequesterID, req.PayerID
+	}
+	var actor models.User
+	if err := tx.First(&actor, actorID).Error; err != nil {
+		return err
+	}
+	amount := formatMoney(req.Amount, req.Currency)
+	var title, body string
+	switch kind {
+	case models.NotificationPaymentRequestCreated:
+		title = "Nova solicitação de pagamento"
+		body = fmt.Sprintf("%s pediu %s a você.", displayName(&actor), amount)
+		if req.Description != "" {
+			body += " " + req.Description
+		}
+	case models.NotificationPaymentRequestDeclined:
+		title = "Solicitação recusada"
+		body = fmt.Sprintf("%s recusou sua solicitação de %s.", displayName(&actor), amount)
+	case models.NotificationPaymentRequestCancelled:
+		title = "Solicitação cancelada"
+		body = fmt.Sprintf("%s cancelou a solicitação de %s.", displayName(&actor), amount)
+	case models.NotificationPaymentRequestReminder:
+		title = "Lembrete de pagamento"
+		outstanding := formatMoney(fromCents(toCents(req.Amount)-toCents(req.AmountPaid)), req.Currency)
+		body = fmt.Sprintf("%s lembrou você da solicitação de %s, faltam %s.", displayName(&actor), amount, outstanding)
+	}
+	return notifyUser(tx, recipientID, kind, title, body, gin.H{"payment_request_id": req.ID})
+}
@@ -1,20 +1,61 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Santannafe12/pagcore-backend/config"
 	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRequestInput struct {
-	PayerUsername string  `json:"payer_username" binding:"required"`
-	Amount        float64 `json:"amount" binding:"required,gt=0"`
-	Description   string  `json:"description"`
+	PayerUsername string     `json:"payer_username" binding:"required"`
+	Amount        float64    `json:"amount" binding:"required,gt=0"`
+	Description   string     `json:"description"`
+	ExpiresAt     *time.Time `json:"expires_at"` // Optional, RFC3339
+	WalletID      *uint      `json:"wallet_id"`  // Receiving wallet, defaults to the default wallet
+}
+
+var (
+	errPaymentRequestClosed  = errors.New("payment request is no longer open")
+	errPaymentRequestExpired = errors.New("payment request has expired")
+	errInvoicePaidInFull     = errors.New("invoices are paid in full")
+	errAboveOutstanding      = errors.New("amount above the outstanding balance")
+	errReminderTooSoon       = errors.New("payment request was reminded recently")
+)
+
+// Minimum interval between two reminders for the same request
+const paymentReminderInterval = time.Hour
+
+func paymentRequestExpired(req *models.PaymentRequest) bool {
+	return req.ExpiresAt != nil && time.Now().UTC().After(*req.ExpiresAt)
+}
+
+// expirePaymentRequestIfStale flips a pending request to expired when its deadline has passed,
+// so read paths don't have to wait for the background job.
+func expirePaymentRequestIfStale(req *models.PaymentRequest) bool {
+	if !paymentRequestOpen(req.Status) || !paymentRequestExpired(req) {
+		return false
+	}
+	req.Status = models.PaymentStatusExpired
+	config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(req).Update("status", models.PaymentStatusExpired).Error; err != nil {
+			return err
+		}
+		if req.GroupID != nil {
+			return settlePaymentGroup(tx, *req.GroupID)
+		}
+		return nil
+	})
+	return true
 }
 
 func CreatePaymentRequest(c *gin.Context) {
@@ -30,60 +71,219 @@ func CreatePaymentRequest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Remetente não encontrado"})
 		return
 	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Data de expiração deve ser no futuro"})
+		return
+	}
+	wallet, err := resolveWallet(config.DB, userID, input.WalletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao solicitar pagamento")
+		return
+	}
 	req := models.PaymentRequest{
 		RequesterID: userID,
 		PayerID:     payer.ID,
 		Amount:      input.Amount,
+		Currency:    wallet.Currency,
+		WalletID:    &wallet.ID,
 		Description: input.Description,
 	}
-	config.DB.Create(&req)
+	if input.ExpiresAt != nil {
+		expiresAt := input.ExpiresAt.UTC()
+		req.ExpiresAt = &expiresAt
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		if err := outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestCreated, payer.ID, &req, nil)); err != nil {
+			return err
+		}
+		return notifyPaymentRequest(tx, models.NotificationPaymentRequestCreated, &req)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao solicitar pagamento"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Pagamento solicitado"})
 }
 
+type AcceptPaymentRequestInput struct {
+	Amount       float64 `json:"amount" binding:"omitempty,gt=0"` // In the request currency, defaults to the outstanding balance
+	FromWalletID *uint   `json:"from_wallet_id"`                  // Defaults to the payer's default wallet
+}
+
+// closePaymentRequest moves an open request to a final status. The update only applies while
+// the request is still open, so it can't overwrite a payment that got there first.
+func closePaymentRequest(tx *gorm.DB, req *models.PaymentRequest, status models.PaymentStatus) error {
+	result := tx.Model(req).Where("status IN ?", []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusPartiallyPaid}).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errPaymentRequestClosed
+	}
+	return nil
+}
+
+// paymentRequestOpen reports whether a request can still receive payments.
+func paymentRequestOpen(status models.PaymentStatus) bool {
+	return status == models.PaymentStatusPending || status == models.PaymentStatusPartiallyPaid
+}
+
 func AcceptPaymentRequest(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	idStr := c.Param("id")
 	id, _ := strconv.Atoi(idStr)
+	var input AcceptPaymentRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var req models.PaymentRequest
 	config.DB.First(&req, id)
-	if req.PayerID != userID || req.Status != models.PaymentStatusPending {
+	if req.PayerID != userID || !paymentRequestOpen(req.Status) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Request inválida"})
 		return
 	}
-	var payer, requester models.User
-	config.DB.First(&payer, userID)
-	config.DB.First(&requester, req.RequesterID)
-	if payer.Balance < req.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo insuficiente"})
+	if expirePaymentRequestIfStale(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitação expirada"})
 		return
 	}
+	if input.Amount > 0 && toCents(input.Amount) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valor inválido"})
+		return
+	}
+	// Amounts are kept in whole cents, like everything already stored
+	input.Amount = fromCents(toCents(input.Amount))
+	var (
+		txRecord  models.Transaction
+		invoice   models.Invoice
+		isInvoice bool
+		charges   invoiceCharges
+		amount    float64
+	)
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
-		payer.Balance -= req.Amount
-		requester.Balance += req.Amount
-		if err := tx.Save(&payer).Error; err != nil {
+		// Reread under a row lock so concurrent payments see each other's amount_paid
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&req, req.ID).Error; err != nil {
+			return err
+		}
+		if !paymentRequestOpen(req.Status) {
+			return errPaymentRequestClosed
+		}
+		if paymentRequestExpired(&req) {
+			return errPaymentRequestExpired
+		}
+		outstandingCents := toCents(req.Amount) - toCents(req.AmountPaid)
+		amount = fromCents(outstandingCents)
+		// Invoices are paid in full, for whatever discount or late charges apply today
+		isInvoice = tx.Where("payment_request_id = ?", req.ID).Limit(1).Find(&invoice).RowsAffected > 0
+		if isInvoice {
+			if req.Status != models.PaymentStatusPending || invoice.PaidAt != nil {
+				return errPaymentRequestClosed
+			}
+			charges = computeInvoiceCharges(&invoice, req.Amount, time.Now())
+			amount = charges.Total
+			if input.Amount > 0 && toCents(input.Amount) != toCents(amount) {
+				return errInvoicePaidInFull
+			}
+		} else if input.Amount > 0 {
+			if toCents(input.Amount) > outstandingCents {
+				return errAboveOutstanding
+			}
+			amount = input.Amount
+		}
+		payerWallet, err := resolveWallet(tx, userID, input.FromWalletID)
+		if err != nil {
+			return err
+		}
+		requesterWallet, err := receivingWallet(tx, req.RequesterID, req.WalletID, req.Currency)
+		if err != nil {
+			return err
+		}
+		move, err := priceCredit(&payerWallet, &requesterWallet, amount)
+		if err != nil {
+			return err
+		}
+		if err := moveBalance(tx, &payerWallet, &requesterWallet, move); err != nil {
+			return err
+		}
+		req.AmountPaid = fromCents(toCents(req.AmountPaid) + toCents(amount))
+		if isInvoice || toCents(req.AmountPaid) >= toCents(req.Amount) {
+			req.Status = models.PaymentStatusAccepted
+		} else {
+			req.Status = models.PaymentStatusPartiallyPaid
+		}
+		if err := tx.Model(&req).Updates(map[string]interface{}{"amount_paid": req.AmountPaid, "status": req.Status}).Error; err != nil {
+			return err
+		}
+		if isInvoice {
+			paidAt := time.Now().UTC()
+			result := tx.Model(&invoice).Where("paid_at IS NULL").Updates(map[string]interface{}{"paid_at": paidAt, "amount_charged": amount})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errPaymentRequestClosed
+			}
+		}
+		if req.GroupID != nil {
+			if err := settlePaymentGroup(tx, *req.GroupID); err != nil {
+				return err
+			}
+		}
+		txRecord = models.Transaction{
+			SenderID:         userID,
+			RecipientID:      req.RequesterID,
+			Description:      "Pagamento Solicitado: " + req.Description,
+			Type:             models.TransactionTypeTransfer,
+			PaymentRequestID: &req.ID,
+		}
+		move.record(&txRecord, &payerWallet, &requesterWallet)
+		if err := tx.Create(&txRecord).Error; err != nil {
+			return err
+		}
+		var payer models.User
+		if err := tx.First(&payer, userID).Error; err != nil {
 			return err
 		}
-		if err := tx.Save(&requester).Error; err != nil {
+		if err := outbox.Publish(tx, transferReceived(req.RequesterID, &txRecord, &payer)); err != nil {
 			return err
 		}
-		req.Status = models.PaymentStatusAccepted
-		if err := tx.Save(&req).Error; err != nil {
+		if err := notifyTransferReceived(tx, models.NotificationPaymentRequestPaid, req.RequesterID, &txRecord, &payer); err != nil {
 			return err
 		}
-		txRecord := models.Transaction{
-			SenderID:    payer.ID,
-			RecipientID: requester.ID,
-			Amount:      req.Amount,
-			Description: "Pagamento Solicitado: " + req.Description,
-			Type:        models.TransactionTypeTransfer,
+		if req.Status != models.PaymentStatusAccepted {
+			return nil
 		}
-		return tx.Create(&txRecord).Error
+		return outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestAccepted, req.RequesterID, &req, invoiceOrNil(isInvoice, &invoice)))
 	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha"})
+	switch {
+	case errors.Is(err, errPaymentRequestClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Solicitação não está mais aberta"})
+		return
+	case errors.Is(err, errPaymentRequestExpired):
+		expirePaymentRequestIfStale(&req)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitação expirada"})
+		return
+	case errors.Is(err, errInvoicePaidInFull):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Faturas devem ser pagas pelo valor total", "amount_due": charges})
+		return
+	case errors.Is(err, errAboveOutstanding):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valor maior que o saldo devedor", "outstanding": amount})
+		return
+	case err != nil:
+		walletErrorResponse(c, err, "Falha")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Aceito"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Aceito",
+		"transaction_id": txRecord.ID,
+		"status":         req.Status,
+		"amount_paid":    req.AmountPaid,
+		"outstanding":    fromCents(max(0, toCents(req.Amount)-toCents(req.AmountPaid))),
+	})
 }
 
 func DeclinePaymentRequest(c *gin.Context) {
@@ -92,25 +292,136 @@ func DeclinePaymentRequest(c *gin.Context) {
 	id, _ := strconv.Atoi(idStr)
 	var req models.PaymentRequest
 	config.DB.First(&req, id)
-	if req.PayerID != userID || req.Status != models.PaymentStatusPending {
+	if req.PayerID != userID || !paymentRequestOpen(req.Status) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Inválido"})
 		return
 	}
-	req.Status = models.PaymentStatusDeclined
-	config.DB.Save(&req)
+	if expirePaymentRequestIfStale(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitação expirada"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := closePaymentRequest(tx, &req, models.PaymentStatusDeclined); err != nil {
+			return err
+		}
+		if req.GroupID != nil {
+			if err := settlePaymentGroup(tx, *req.GroupID); err != nil {
+				return err
+			}
+		}
+		if err := outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestDeclined, req.RequesterID, &req, nil)); err != nil {
+			return err
+		}
+		return notifyPaymentRequest(tx, models.NotificationPaymentRequestDeclined, &req)
+	})
+	if errors.Is(err, errPaymentRequestClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Solicitação não está mais aberta"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao recusar"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Recusado"})
 }
 
+func CancelPaymentRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	idStr := c.Param("id")
+	id, _ := strconv.Atoi(idStr)
+	var req models.PaymentRequest
+	config.DB.First(&req, id)
+	if req.RequesterID != userID || !paymentRequestOpen(req.Status) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Inválido"})
+		return
+	}
+	if expirePaymentRequestIfStale(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitação expirada"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := closePaymentRequest(tx, &req, models.PaymentStatusCancelled); err != nil {
+			return err
+		}
+		if req.GroupID != nil {
+			if err := settlePaymentGroup(tx, *req.GroupID); err != nil {
+				return err
+			}
+		}
+		if err := outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestCancelled, req.PayerID, &req, nil)); err != nil {
+			return err
+		}
+		return notifyPaymentRequest(tx, models.NotificationPaymentRequestCancelled, &req)
+	})
+	if errors.Is(err, errPaymentRequestClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Solicitação não está mais aberta"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao cancelar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cancelado"})
+}
+
+func RemindPaymentRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	idStr := c.Param("id")
+	id, _ := strconv.Atoi(idStr)
+	var req models.PaymentRequest
+	config.DB.First(&req, id)
+	if req.RequesterID != userID || !paymentRequestOpen(req.Status) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Inválido"})
+		return
+	}
+	if expirePaymentRequestIfStale(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitação expirada"})
+		return
+	}
+	now := time.Now().UTC()
+	if req.RemindedAt != nil && now.Before(req.RemindedAt.Add(paymentReminderInterval)) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":          "Lembrete enviado recentemente",
+			"next_remind_at": req.RemindedAt.Add(paymentReminderInterval).Format(time.RFC3339),
+		})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Only one of two concurrent reminders gets through the interval check
+		result := tx.Model(&req).Where("reminded_at IS NULL OR reminded_at <= ?", now.Add(-paymentReminderInterval)).
+			Updates(map[string]interface{}{"reminded_at": now, "reminder_count": gorm.Expr("reminder_count + 1")})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReminderTooSoon
+		}
+		if err := tx.Select("reminder_count").First(&req, req.ID).Error; err != nil {
+			return err
+		}
+		return notifyPaymentRequest(tx, models.NotificationPaymentRequestReminder, &req)
+	})
+	if errors.Is(err, errReminderTooSoon) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Lembrete enviado recentemente"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao enviar lembrete"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Lembrete enviado", "reminder_count": req.ReminderCount})
+}
+
 func GetPaymentRequests(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	var sentRequests []models.PaymentRequest
 	var receivedRequests []models.PaymentRequest
 
 	// Fetch sent requests (where user is the requester)
-	config.DB.Preload("Requester").Preload("Payer").Where("requester_id = ?", userID).Find(&sentRequests)
+	config.DB.Preload("Requester").Preload("Payer").Preload("Payments").Preload("Invoice.Items").Where("requester_id = ?", userID).Find(&sentRequests)
 
 	// Fetch received requests (where user is the payer)
-	config.DB.Preload("Requester").Preload("Payer").Where("payer_id = ?", userID).Find(&receivedRequests)
+	config.DB.Preload("Requester").Preload("Payer").Preload("Payments").Preload("Invoice.Items").Where("payer_id = ?", userID).Find(&receivedRequests)
 
 	c.JSON(http.StatusOK, gin.H{
 		"sent":     sentRequests,
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SplitParticipantInput struct {
+	PayerUsername string  `json:"payer_username" binding:"required"`
+	Amount        float64 `json:"amount" binding:"omitempty,gt=0"` // Only used for custom splits
+}
+
+type SplitPaymentRequestInput struct {
+	TotalAmount  float64                 `json:"total_amount" binding:"required,gt=0"`
+	Description  string                  `json:"description"`
+	SplitMode    models.PaymentSplitMode `json:"split_mode" binding:"required,oneof=even custom"`
+	Participants []SplitParticipantInput `json:"participants" binding:"required,min=1,dive"`
+}
+
+// toCents avoids float drift when splitting or summing amounts.
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// splitEvenly divides total into n shares, giving the leftover cents to the first payers.
+func splitEvenly(total float64, n int) []float64 {
+	totalCents := toCents(total)
+	base := totalCents / int64(n)
+	remainder := totalCents % int64(n)
+	shares := make([]float64, n)
+	for i := range shares {
+		cents := base
+		if int64(i) < remainder {
+			cents++
+		}
+		shares[i] = fromCents(cents)
+	}
+	return shares
+}
+
+func CreateSplitPaymentRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input SplitPaymentRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payers := make([]models.User, len(input.Participants))
+	seen := make(map[uint]bool)
+	for i, p := range input.Participants {
+		config.DB.Where("username = ?", p.PayerUsername).First(&payers[i])
+		if payers[i].ID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Remetente não encontrado: " + p.PayerUsername})
+			return
+		}
+		if payers[i].ID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Não pode solicitar pagamento a si mesmo"})
+			return
+		}
+		if seen[payers[i].ID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Participante duplicado: " + p.PayerUsername})
+			return
+		}
+		seen[payers[i].ID] = true
+	}
+
+	var shares []float64
+	if input.SplitMode == models.PaymentSplitModeEven {
+		if toCents(input.TotalAmount) < int64(len(payers)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Valor total muito baixo para dividir"})
+			return
+		}
+		shares = splitEvenly(input.TotalAmount, len(payers))
+	} else {
+		var sum int64
+		shares = make([]float64, len(payers))
+		for i, p := range input.Participants {
+			if p.Amount <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Valor obrigatório para cada participante"})
+				return
+			}
+			shares[i] = p.Amount
+			sum += toCents(p.Amount)
+		}
+		if sum != toCents(input.TotalAmount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A soma das partes deve ser igual ao valor total"})
+			return
+		}
+	}
+
+	wallet, err := defaultWallet(config.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar divisão"})
+		return
+	}
+	group := models.PaymentGroup{
+		RequesterID: userID,
+		TotalAmount: input.TotalAmount,
+		Currency:    wallet.Currency,
+		Description: input.Description,
+		SplitMode:   input.SplitMode,
+		Status:      models.PaymentGroupStatusOpen,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		for i, payer := range payers {
+			req := models.PaymentRequest{
+				RequesterID: userID,
+				PayerID:     payer.ID,
+				Amount:      shares[i],
+				Currency:    wallet.Currency,
+				WalletID:    &wallet.ID,
+				Description: input.Description,
+				GroupID:     &group.ID,
+			}
+			if err := tx.Create(&req).Error; err != nil {
+				return err
+			}
+			if err := outbox.Publish(tx, paymentRequestEvent(outbox.EventPaymentRequestCreated, payer.ID, &req, nil)); err != nil {
+				return err
+			}
+			if err := notifyPaymentRequest(tx, models.NotificationPaymentRequestCreated, &req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar divisão"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Pagamento dividido solicitado", "id": group.ID})
+}
+
+func GetSplitPaymentRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	var group models.PaymentGroup
+	if err := config.DB.Preload("Requester").Preload("Participants.Payer").First(&group, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Divisão não encontrada"})
+		return
+	}
+	allowed := group.RequesterID == userID
+	for _, p := range group.Participants {
+		if p.PayerID == userID {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado"})
+		return
+	}
+	// Participants see each other, so only names go out, never the accounts behind them
+	participants := make([]gin.H, len(group.Participants))
+	for i, p := range group.Participants {
+		participants[i] = gin.H{
+			"id":          p.ID,
+			"payer":       p.Payer.Username,
+			"payer_name":  p.Payer.FullName,
+			"amount":      p.Amount,
+			"amount_paid": p.AmountPaid,
+			"status":      p.Status,
+			"expires_at":  formatExpiry(p.ExpiresAt),
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":             group.ID,
+		"requester":      group.Requester.Username,
+		"requester_name": displayName(&group.Requester),
+		"total_amount":   group.TotalAmount,
+		"currency":       group.Currency,
+		"description":    group.Description,
+		"split_mode":     group.SplitMode,
+		"status":         group.Status,
+		"participants":   participants,
+		"settled_at":     group.SettledAt,
+		"created_at":     group.CreatedAt,
+	})
+}
+
+// settlePaymentGroup moves the group to a final status once no participant can still pay:
+// settled when everyone paid, closed when someone declined, cancelled or let the request expire.
+func settlePaymentGroup(tx *gorm.DB, groupID uint) error {
+	// Lock the group so the last two payers can't each see the other as still pending
+	var group models.PaymentGroup
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, groupID).Error; err != nil {
+		return err
+	}
+	if group.Status != models.PaymentGroupStatusOpen {
+		return nil
+	}
+	var open, unpaid int64
+	if err := tx.Model(&models.PaymentRequest{}).
+		Where("group_id = ? AND status IN ?", groupID, []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusPartiallyPaid}).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+	if err := tx.Model(&models.PaymentRequest{}).
+		Where("group_id = ? AND status <> ?", groupID, models.PaymentStatusAccepted).
+		Count(&unpaid).Error; err != nil {
+		return err
+	}
+	if unpaid > 0 {
+		return tx.Model(&group).Update("status", models.PaymentGroupStatusClosed).Error
+	}
+	now := time.Now().UTC()
+	return tx.Model(&group).
+		Updates(map[string]interface{}{"status": models.PaymentGroupStatusSettled, "settled_at": now}).Error
+}
@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	paymentLinkTokenLength    = 22
+	defaultPaymentLinkBaseURL = "http://localhost:3000/pay/"
+)
+
+var errPaymentLinkUnavailable = errors.New("payment link expired or used up")
+
+type CreatePaymentLinkInput struct {
+	Amount           *float64 `json:"amount" binding:"omitempty,gt=0"` // Omit for an open amount link
+	Description      string   `json:"description" binding:"max=140"`
+	WalletID         *uint    `json:"wallet_id"`                                   // Receiving wallet, defaults to the default wallet
+	ExpiresInMinutes *int     `json:"expires_in_minutes" binding:"omitempty,gt=0"` // Never expires when omitted
+	MaxUses          *int     `json:"max_uses" binding:"omitempty,gt=0"`           // Unlimited when omitted
+	RedirectURL      string   `json:"redirect_url"`                                // http or https
+}
+
+// paymentLinkURL is the hosted checkout page for a link, configured with PAYMENT_LINK_BASE_URL.
+func paymentLinkURL(token string) string {
+	base := os.Getenv("PAYMENT_LINK_BASE_URL")
+	if base == "" {
+		base = defaultPaymentLinkBaseURL
+	}
+	return base + token
+}
+
+func validRedirectURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func paymentLinkExpired(link *models.PaymentLink) bool {
+	return link.Status == models.PaymentLinkStatusExpired ||
+		(link.ExpiresAt != nil && time.Now().UTC().After(*link.ExpiresAt))
+}
+
+// paymentLinkStatus is the status clients see, expired links may still be active in the DB.
+func paymentLinkStatus(link *models.PaymentLink) models.PaymentLinkStatus {
+	if link.Status == models.PaymentLinkStatusActive && paymentLinkExpired(link) {
+		return models.PaymentLinkStatusExpired
+	}
+	return link.Status
+}
+
+func paymentLinkResponse(link *models.PaymentLink) gin.H {
+	return gin.H{
+		"id":           link.ID,
+		"token":        link.Token,
+		"url":          paymentLinkURL(link.Token),
+		"amount":       link.Amount,
+		"currency":     link.Currency,
+		"description":  link.Description,
+		"redirect_url": link.RedirectURL,
+		"status":       paymentLinkStatus(link),
+		"use_count":    link.UseCount,
+		"max_uses":     link.MaxUses,
+		"created_at":   link.CreatedAt,
+		"expires_at":   formatExpiry(link.ExpiresAt),
+		"cancelled_at": formatExpiry(link.CancelledAt),
+	}
+}
+
+func CreatePaymentLink(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input CreatePaymentLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.RedirectURL != "" && !validRedirectURL(input.RedirectURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL de redirecionamento inválida"})
+		return
+	}
+	wallet, err := resolveWallet(config.DB, userID, input.WalletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao criar link de pagamento")
+		return
+	}
+	token, err := randomToken(paymentLinkTokenLength)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar link de pagamento"})
+		return
+	}
+	link := models.PaymentLink{
+		UserID:      userID,
+		Token:       token,
+		WalletID:    &wallet.ID,
+		Amount:      input.Amount,
+		Currency:    wallet.Currency,
+		Description: input.Description,
+		RedirectURL: input.RedirectURL,
+		Status:      models.PaymentLinkStatusActive,
+		MaxUses:     input.MaxUses,
+	}
+	if input.ExpiresInMinutes != nil {
+		expiresAt := time.Now().UTC().Add(time.Duration(*input.ExpiresInMinutes) * time.Minute)
+		link.ExpiresAt = &expiresAt
+	}
+	if err := config.DB.Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar link de pagamento"})
+		return
+	}
+	c.JSON(http.StatusOK, paymentLinkResponse(&link))
+}
+
+// GetPaymentLinks lists the user's payment links, newest first, optionally filtered by status.
+func GetPaymentLinks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	now := time.Now().UTC()
+	query := config.DB.Where("user_id = ?", userID)
+	switch models.PaymentLinkStatus(c.Query("status")) {
+	case "":
+	case models.PaymentLinkStatusActive:
+		query = query.Where("status = ? AND (expires_at IS NULL OR expires_at > ?)", models.PaymentLinkStatusActive, now)
+	case models.PaymentLinkStatusExpired:
+		query = query.Where("status = ? OR (status = ? AND expires_at <= ?)", models.PaymentLinkStatusExpired, models.PaymentLinkStatusActive, now)
+	case models.PaymentLinkStatusCancelled:
+		query = query.Where("status = ?", models.PaymentLinkStatusCancelled)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status inválido"})
+		return
+	}
+	var links []models.PaymentLink
+	query.Order("created_at desc").Find(&links)
+	result := make([]gin.H, len(links))
+	for i := range links {
+		result[i] = paymentLinkResponse(&links[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPaymentLinkPayments lists the payments received through one of the user's links.
+func GetPaymentLinkPayments(c *gin.Context) {
+	var link models.PaymentLink
+	if err := config.DB.Where("token = ? AND user_id = ?", c.Param("token"), c.GetUint("user_id")).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link de pagamento não encontrado"})
+		return
+	}
+	var payments []models.Transaction
+	config.DB.Preload("Sender").Where("payment_link_id = ? AND type = ?", link.ID, models.TransactionTypeTransfer).
+		Order("created_at desc").Find(&payments)
+	response := paymentLinkResponse(&link)
+	response["payments"] = paymentsReceived(payments)
+	c.JSON(http.StatusOK, response)
+}
+
+func CancelPaymentLink(c *gin.Context) {
+	var link models.PaymentLink
+	if err := config.DB.Where("token = ? AND user_id = ?", c.Param("token"), c.GetUint("user_id")).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link de pagamento não encontrado"})
+		return
+	}
+	result := config.DB.Model(&models.PaymentLink{}).
+		Where("id = ? AND status = ? AND (expires_at IS NULL OR expires_at > ?)", link.ID, models.PaymentLinkStatusActive, time.Now().UTC()).
+		Updates(map[string]interface{}{"status": models.PaymentLinkStatusCancelled, "cancelled_at": time.Now().UTC()})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao cancelar link de pagamento"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Só é possível cancelar links ativos"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Link de pagamento cancelado"})
+}
+
+// GetPublicPaymentLink serves the hosted checkout without authentication, so it only shows what
+// the payer needs to decide.
+func GetPublicPaymentLink(c *gin.Context) {
+	var link models.PaymentLink
+	if err := config.DB.Preload("User").Where("token = ?", c.Param("token")).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link de pagamento não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":          link.Token,
+		"recipient_name": displayName(&link.User),
+		"amount":         link.Amount,
+		"currency":       link.Currency,
+		"description":    link.Description,
+		"status":         paymentLinkStatus(&link),
+		"expires_at":     formatExpiry(link.ExpiresAt),
+	})
+}
+
+type PayPaymentLinkInput struct {
+	Amount       float64 `json:"amount" binding:"omitempty,gt=0"` // Required for open amount links, in the link currency
+	FromWalletID *uint   `json:"from_wallet_id"`                  // Defaults to the payer's default wallet
+}
+
+func claimPaymentLinkUse(tx *gorm.DB, link *models.PaymentLink) error {
+	result := tx.Model(&models.PaymentLink{}).
+		Where("id = ? AND status = ? AND (max_uses IS NULL OR use_count < max_uses)", link.ID, models.PaymentLinkStatusActive).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errPaymentLinkUnavailable
+	}
+	link.UseCount++
+	if link.MaxUses != nil && link.UseCount >= *link.MaxUses {
+		link.Status = models.PaymentLinkStatusExpired
+		return tx.Model(link).Update("status", models.PaymentLinkStatusExpired).Error
+	}
+	return nil
+}
+
+// PayPaymentLink pays a link through the transfer engine. The amount is fixed on the receiving
+// side, so payers in another currency are charged whatever converts to it.
+func PayPaymentLink(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input PayPaymentLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var link models.PaymentLink
+	if err := config.DB.Where("token = ?", c.Param("token")).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link de pagamento não encontrado"})
+		return
+	}
+	if link.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Não pode pagar o seu próprio link"})
+		return
+	}
+	switch paymentLinkStatus(&link) {
+	case models.PaymentLinkStatusCancelled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link de pagamento cancelado"})
+		return
+	case models.PaymentLinkStatusExpired:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link de pagamento expirado", "expires_at": formatExpiry(link.ExpiresAt)})
+		return
+	}
+	// Open amounts are typed by the payer, kept in whole cents like every other amount
+	amount := fromCents(toCents(input.Amount))
+	if link.Amount != nil {
+		amount = *link.Amount
+	} else if amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o valor a pagar"})
+		return
+	}
+	var txRecord models.Transaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var payer models.User
+		if err := tx.First(&payer, userID).Error; err != nil {
+			return err
+		}
+		from, err := resolveWallet(tx, userID, input.FromWalletID)
+		if err != nil {
+			return err
+		}
+		to, err := receivingWallet(tx, link.UserID, link.WalletID, link.Currency)
+		if err != nil {
+			return err
+		}
+		move, err := priceCredit(&from, &to, amount)
+		if err != nil {
+			return err
+		}
+		if err := moveBalance(tx, &from, &to, move); err != nil {
+			return err
+		}
+		if err := claimPaymentLinkUse(tx, &link); err != nil {
+			return err
+		}
+		txRecord = models.Transaction{
+			SenderID:      userID,
+			RecipientID:   link.UserID,
+			Description:   link.Description,
+			Type:          models.TransactionTypeTransfer,
+			PaymentLinkID: &link.ID,
+		}
+		move.record(&txRecord, &from, &to)
+		if err := tx.Create(&txRecord).Error; err != nil {
+			return err
+		}
+		if err := outbox.Publish(tx, transferReceived(link.UserID, &txRecord, &payer)); err != nil {
+			return err
+		}
+		if err := notifyTransferReceived(tx, models.NotificationPaymentLinkPaid, link.UserID, &txRecord, &payer); err != nil {
+			return err
+		}
+		return chargeFee(tx, models.FeeTransactionTransfer, &payer, &from, &txRecord)
+	})
+	if errors.Is(err, errPaymentLinkUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link de pagamento indisponível"})
+		return
+	}
+	if err != nil {
+		walletErrorResponse(c, err, "Falha no Pagamento")
+		return
+	}
+	response := gin.H{"message": "Pagamento Efetuado.", "transaction_id": txRecord.ID}
+	if link.RedirectURL != "" {
+		if u, err := url.Parse(link.RedirectURL); err == nil {
+			q := u.Query()
+			q.Set("status", "paid")
+			q.Set("link", link.Token)
+			q.Set("transaction_id", strconv.FormatUint(uint64(txRecord.ID), 10))
+			u.RawQuery = q.Encode()
+			response["redirect_url"] = u.String()
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
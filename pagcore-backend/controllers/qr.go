@@ -2,22 +2,62 @@
 package controllers
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
+	"github.com/Santannafe12/pagcore-backend/brcode"
 	"github.com/Santannafe12/pagcore-backend/config"
 	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
 
 	"github.com/gin-gonic/gin"
-	"github.com/skip2/go-qrcode"
 	"gorm.io/gorm"
 )
 
 type GenerateQRInput struct {
-	Amount float64 `json:"amount" binding:"required,gt=0"` // Enforce amount > 0
+	Type             models.QRType `json:"type" binding:"omitempty,oneof=single_use multi_use open_amount"` // Defaults to single_use
+	Amount           float64       `json:"amount" binding:"omitempty,gt=0"`                                 // Required unless open_amount
+	WalletID         *uint         `json:"wallet_id"`                                                       // Receiving wallet, defaults to the default wallet
+	ExpiresInMinutes *int          `json:"expires_in_minutes" binding:"omitempty,gt=0"`                     // Single use codes default to 10, others never expire
+	MaxUses          *int          `json:"max_uses" binding:"omitempty,gt=0"`                               // Ignored for single use codes
+}
+
+var errQRUnavailable = errors.New("qr code expired or used up")
+
+// qrExpired also checks the deadline, the expiry job only catches up once a minute.
+func qrExpired(qr *models.QRCode) bool {
+	return qr.Status == models.QRStatusExpired ||
+		(qr.ExpiresAt != nil && time.Now().UTC().After(*qr.ExpiresAt))
+}
+
+// qrStatus is the status clients see, expired codes may still be active in the DB.
+func qrStatus(qr *models.QRCode) models.QRStatus {
+	if qr.Status == models.QRStatusActive && qrExpired(qr) {
+		return models.QRStatusExpired
+	}
+	return qr.Status
+}
+
+// rejectUnusableQR answers for cancelled or expired codes and reports whether it did.
+func rejectUnusableQR(c *gin.Context, qr *models.QRCode) bool {
+	if qr.Status == models.QRStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code cancelado"})
+		return true
+	}
+	if qrExpired(qr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code expirado", "expires_at": formatExpiry(qr.ExpiresAt)})
+		return true
+	}
+	return false
+}
+
+func formatExpiry(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339)
 }
 
 func GenerateQR(c *gin.Context) {
@@ -27,35 +67,77 @@ func GenerateQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	expiresAt := time.Now().UTC().Add(10 * time.Minute) // Use UTC for consistency
-	qr := models.QRCode{
-		UserID:    userID,
-		Amount:    input.Amount,
-		Status:    models.QRStatusActive,
-		ExpiresAt: expiresAt,
+	wallet, err := resolveWallet(config.DB, userID, input.WalletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao criar QR Code")
+		return
 	}
-	if err := config.DB.Create(&qr).Error; err != nil {
+	if input.Type == "" {
+		input.Type = models.QRTypeSingleUse
+	}
+	// Amounts are kept in whole cents, like everything already stored
+	input.Amount = fromCents(toCents(input.Amount))
+	if input.Type == models.QRTypeOpenAmount {
+		input.Amount = 0
+	} else if input.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valor obrigatório para QR Code de valor fixo"})
+		return
+	}
+	if input.Type == models.QRTypeSingleUse {
+		one := 1
+		input.MaxUses = &one
+		if input.ExpiresInMinutes == nil {
+			ten := 10
+			input.ExpiresInMinutes = &ten
+		}
+	}
+	token, err := randomToken(qrTokenLength)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar QR Code"})
 		return
 	}
-	fmt.Printf("Created QR code with ID: %d, Amount: %f, ExpiresAt: %s\n", qr.ID, qr.Amount, qr.ExpiresAt.Format(time.RFC3339))
-	qrContent := "pagcore:" + strconv.Itoa(int(qr.ID))
-	png, err := qrcode.Encode(qrContent, qrcode.Medium, 256)
+	qr := models.QRCode{
+		UserID:   userID,
+		Token:    token,
+		WalletID: &wallet.ID,
+		Type:     input.Type,
+		Amount:   input.Amount,
+		Currency: wallet.Currency,
+		Status:   models.QRStatusActive,
+		MaxUses:  input.MaxUses,
+	}
+	if input.ExpiresInMinutes != nil {
+		expiresAt := time.Now().UTC().Add(time.Duration(*input.ExpiresInMinutes) * time.Minute) // Use UTC for consistency
+		qr.ExpiresAt = &expiresAt
+	}
+	var owner models.User
+	config.DB.First(&owner, userID)
+	qrContent, err := encodeQRPayload(&qr, &owner)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha em gerar imagem QR Code"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha em gerar conteúdo do QR Code"})
 		return
 	}
-	base64QR := base64.StdEncoding.EncodeToString(png)
-	qr.QRCode = base64QR
-	if err := config.DB.Save(&qr).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha em atualizar QR Code"})
+	qr.Payload = qrContent
+	if err := config.DB.Create(&qr).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar QR Code"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"qr_code": base64QR, "id": qr.ID, "expires_at": qr.ExpiresAt.Format(time.RFC3339)})
+	fmt.Printf("Created %s QR code with ID: %d, Amount: %f, ExpiresAt: %v\n", qr.Type, qr.ID, qr.Amount, formatExpiry(qr.ExpiresAt))
+	c.JSON(http.StatusOK, gin.H{
+		"id":         qr.ID,
+		"token":      qr.Token,
+		"type":       qr.Type,
+		"payload":    qrContent,
+		"image_url":  "/api/qr/" + qr.Token + "/image",
+		"expires_at": formatExpiry(qr.ExpiresAt),
+	})
 }
 
 type ProcessQRInput struct {
-	QRCodeID uint `json:"qr_code_id" binding:"required"`
+	Token        string  `json:"token" binding:"required_without=Payload"`
+	Payload      string  `json:"payload"`                         // Signed BR Code read from the image, used instead of token
+	Amount       float64 `json:"amount" binding:"omitempty,gt=0"` // Required for open amount codes, ignored otherwise
+	FromWalletID *uint   `json:"from_wallet_id"`                  // Defaults to the payer's default wallet
 }
 
 func ProcessQR(c *gin.Context) {
@@ -65,9 +147,21 @@ func ProcessQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	var payload *brcode.Payload
+	if input.Payload != "" {
+		p, token, err := decodeQRPayload(input.Payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code inválido"})
+			return
+		}
+		payload, input.Token = &p, token
+	}
 	var qr models.QRCode
-	if err := config.DB.First(&qr, input.QRCodeID).Error; err != nil {
-		fmt.Printf("QR code %d not found\n", input.QRCodeID)
+	if err := config.DB.Preload("User").Where("token = ?", input.Token).First(&qr).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code inválido"})
+		return
+	}
+	if payload != nil && !payloadMatchesQR(payload, &qr) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code inválido"})
 		return
 	}
@@ -75,12 +169,20 @@ func ProcessQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Não pode pagar o seu próprio QR Code."})
 		return
 	}
-	fmt.Printf("Processing QR code %d, Status: %s, ExpiresAt: %s, CurrentTime: %s\n",
-		qr.ID, qr.Status, qr.ExpiresAt.Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
-	if qr.Status == models.QRStatusExpired || time.Now().UTC().After(qr.ExpiresAt.Add(30*time.Second)) { // Add 30s grace period
-		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code expirado", "expires_at": qr.ExpiresAt.Format(time.RFC3339)})
+	fmt.Printf("Processing QR code %d, Status: %s, ExpiresAt: %v, CurrentTime: %s\n",
+		qr.ID, qr.Status, formatExpiry(qr.ExpiresAt), time.Now().UTC().Format(time.RFC3339))
+	if rejectUnusableQR(c, &qr) {
 		return
 	}
+	amount := qr.Amount
+	if qr.Type == models.QRTypeOpenAmount {
+		// Open amounts are typed by the payer, kept in whole cents like every other amount
+		amount = fromCents(toCents(input.Amount))
+		if amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Informe o valor a pagar"})
+			return
+		}
+	}
 	var scanner, recipient models.User
 	if err := config.DB.First(&scanner, userID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário não encontrado"})
@@ -90,62 +192,131 @@ func ProcessQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Usuário não encontrado"})
 		return
 	}
-	if scanner.Balance < qr.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo Insuficiente"})
-		return
-	}
+	var txRecord models.Transaction
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
-		scanner.Balance -= qr.Amount
-		recipient.Balance += qr.Amount
-		if err := tx.Save(&scanner).Error; err != nil {
+		scannerWallet, err := resolveWallet(tx, scanner.ID, input.FromWalletID)
+		if err != nil {
 			return err
 		}
-		if err := tx.Save(&recipient).Error; err != nil {
+		recipientWallet, err := receivingWallet(tx, recipient.ID, qr.WalletID, qr.Currency)
+		if err != nil {
 			return err
 		}
-		qr.Status = models.QRStatusExpired
-		if err := tx.Save(&qr).Error; err != nil {
+		move, err := priceCredit(&scannerWallet, &recipientWallet, amount)
+		if err != nil {
+			return err
+		}
+		if err := moveBalance(tx, &scannerWallet, &recipientWallet, move); err != nil {
+			return err
+		}
+		if err := claimQRUse(tx, &qr); err != nil {
 			return err
 		}
-		txRecord := models.Transaction{
+		txRecord = models.Transaction{
 			SenderID:    userID,
 			RecipientID: qr.UserID,
-			Amount:      qr.Amount,
 			Type:        models.TransactionTypeTransfer,
 			QRCodeID:    &qr.ID,
 		}
-		return tx.Create(&txRecord).Error
+		move.record(&txRecord, &scannerWallet, &recipientWallet)
+		if err := tx.Create(&txRecord).Error; err != nil {
+			return err
+		}
+		if err := outbox.Publish(tx, transferReceived(qr.UserID, &txRecord, &scanner)); err != nil {
+			return err
+		}
+		if err := notifyTransferReceived(tx, models.NotificationQRPaid, qr.UserID, &txRecord, &scanner); err != nil {
+			return err
+		}
+		data := transferEventData(&txRecord, &scanner)
+		data["qr_code_token"] = qr.Token
+		qrPaid := outbox.Event{Type: outbox.EventQRPaid, UserID: qr.UserID, Aggregate: outbox.AggregateQRCode, AggregateID: qr.ID, Data: data}
+		if err := outbox.Publish(tx, qrPaid); err != nil {
+			return err
+		}
+		return chargeFee(tx, models.FeeTransactionQRPayment, &scanner, &scannerWallet, &txRecord)
 	})
+	if errors.Is(err, errQRUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code indisponível"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha no Pagamento"})
+		walletErrorResponse(c, err, "Falha no Pagamento")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Pagamento Efetuado."})
+	c.JSON(http.StatusOK, gin.H{"message": "Pagamento Efetuado.", "transaction_id": txRecord.ID})
 }
 
-func GetQR(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "QR Code Inválido"})
-		return
+// claimQRUse counts one payment against the code, expiring it once it reaches MaxUses.
+// The conditional update keeps two concurrent payers from both using a single use code.
+func claimQRUse(tx *gorm.DB, qr *models.QRCode) error {
+	result := tx.Model(&models.QRCode{}).
+		Where("id = ? AND status = ? AND (max_uses IS NULL OR use_count < max_uses)", qr.ID, models.QRStatusActive).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return errQRUnavailable
+	}
+	qr.UseCount++
+	if qr.MaxUses != nil && qr.UseCount >= *qr.MaxUses {
+		qr.Status = models.QRStatusExpired
+		return tx.Model(qr).Update("status", models.QRStatusExpired).Error
+	}
+	return nil
+}
+
+func GetQR(c *gin.Context) {
+	token := c.Param("token")
 	var qr models.QRCode
-	if err := config.DB.Preload("User").First(&qr, id).Error; err != nil {
-		fmt.Printf("QR code %d not found\n", id)
+	if err := config.DB.Preload("User").Where("token = ?", token).First(&qr).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "QR Code não encontrado"})
 		return
 	}
-	fmt.Printf("Retrieved QR code %d, Status: %s, ExpiresAt: %s, CurrentTime: %s\n",
-		qr.ID, qr.Status, qr.ExpiresAt.Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
-	if qr.Status == models.QRStatusExpired || time.Now().UTC().After(qr.ExpiresAt.Add(30*time.Second)) { // Add 30s grace period
-		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code expirado", "expires_at": qr.ExpiresAt.Format(time.RFC3339)})
+	fmt.Printf("Retrieved QR code %d, Status: %s, ExpiresAt: %v, CurrentTime: %s\n",
+		qr.ID, qr.Status, formatExpiry(qr.ExpiresAt), time.Now().UTC().Format(time.RFC3339))
+	if rejectUnusableQR(c, &qr) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"id":             qr.ID,
+		"token":          qr.Token,
+		"type":           qr.Type,
 		"amount":         qr.Amount,
+		"currency":       qr.Currency,
 		"recipient":      qr.User.Username,
-		"recipient_name": qr.User.FullName,
+		"recipient_name": displayName(&qr.User),
+		"expires_at":     formatExpiry(qr.ExpiresAt),
+	})
+}
+
+// GetQRPayments lists the payments received through one of the user's QR codes.
+func GetQRPayments(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var qr models.QRCode
+	if err := config.DB.Where("token = ? AND user_id = ?", c.Param("token"), userID).First(&qr).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR Code não encontrado"})
+		return
+	}
+	var payments []models.Transaction
+	config.DB.Preload("Sender").Where("qr_code_id = ? AND type = ?", qr.ID, models.TransactionTypeTransfer).
+		Order("created_at desc").Find(&payments)
+	c.JSON(http.StatusOK, gin.H{
+		"id":        qr.ID,
+		"type":      qr.Type,
+		"status":    qrStatus(&qr),
+		"use_count": qr.UseCount,
+		"max_uses":  qr.MaxUses,
+		"payments":  paymentsReceived(payments),
 	})
 }
+
+// paymentsReceived shows the payee what they got and from whom, without the rest of the payer's account.
+func paymentsReceived(payments []models.Transaction) []gin.H {
+	result := make([]gin.H, len(payments))
+	for i := range payments {
+		result[i] = transferEventData(&payments[i], &payments[i].Sender)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/qrimage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const qrImageMaxAge = 24 * time.Hour
+
+// qrImageOptions reads format, size, level, fg, bg and logo from the query string.
+func qrImageOptions(c *gin.Context) (qrimage.Options, error) {
+	opts := qrimage.DefaultOptions()
+	if format := c.Query("format"); format != "" {
+		if format != qrimage.FormatPNG && format != qrimage.FormatSVG {
+			return opts, qrimage.ErrInvalidOptions
+		}
+		opts.Format = format
+	}
+	if size := c.Query("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < qrimage.MinSize || n > qrimage.MaxSize {
+			return opts, qrimage.ErrInvalidOptions
+		}
+		opts.Size = n
+	}
+	if level := c.Query("level"); level != "" {
+		l, err := qrimage.ParseLevel(level)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = l
+	}
+	var err error
+	if fg := c.Query("fg"); fg != "" {
+		if opts.Foreground, err = qrimage.ParseColor(fg); err != nil {
+			return opts, err
+		}
+	}
+	if bg := c.Query("bg"); bg != "" {
+		if opts.Background, err = qrimage.ParseColor(bg); err != nil {
+			return opts, err
+		}
+	}
+	if logo, _ := strconv.ParseBool(c.Query("logo")); logo {
+		if config.QRLogo == nil {
+			return opts, qrimage.ErrInvalidOptions
+		}
+		opts.Logo = config.QRLogo
+	}
+	return opts, nil
+}
+
+// GetQRImage renders the stored payload of a QR code on demand. The payload never changes,
+// so the ETag only depends on it and on the rendering options.
+func GetQRImage(c *gin.Context) {
+	var qr models.QRCode
+	if err := config.DB.Where("token = ?", c.Param("token")).First(&qr).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR Code não encontrado"})
+		return
+	}
+	if rejectUnusableQR(c, &qr) {
+		return
+	}
+	opts, err := qrImageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Opções de imagem inválidas"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%x|%x|%t",
+		qr.Payload, opts.Format, opts.Size, opts.Level, opts.Foreground, opts.Background, opts.Logo != nil)))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	maxAge := qrImageMaxAge
+	if qr.ExpiresAt != nil {
+		if left := time.Until(*qr.ExpiresAt); left < maxAge {
+			maxAge = left
+		}
+		if maxAge < 0 {
+			maxAge = 0
+		}
+	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	c.Header("Last-Modified", qr.CreatedAt.UTC().Format(http.TimeFormat))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, contentType, err := qrimage.Render(qr.Payload, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha em gerar imagem do QR Code"})
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
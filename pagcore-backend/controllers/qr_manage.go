@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetQRCodes lists the QR codes the user generated, newest first, with what each one received.
+// Filters: status (active, expired, cancelled), type, wallet_id, from_date and to_date.
+func GetQRCodes(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	now := time.Now().UTC()
+	query := config.DB.Where("user_id = ?", userID)
+	switch models.QRStatus(c.Query("status")) {
+	case "":
+	case models.QRStatusActive:
+		query = query.Where("status = ? AND (expires_at IS NULL OR expires_at > ?)", models.QRStatusActive, now)
+	case models.QRStatusExpired:
+		query = query.Where("status = ? OR (status = ? AND expires_at <= ?)", models.QRStatusExpired, models.QRStatusActive, now)
+	case models.QRStatusCancelled:
+		query = query.Where("status = ?", models.QRStatusCancelled)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status inválido"})
+		return
+	}
+	switch qrType := models.QRType(c.Query("type")); qrType {
+	case "":
+	case models.QRTypeSingleUse, models.QRTypeMultiUse, models.QRTypeOpenAmount:
+		query = query.Where("type = ?", qrType)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo inválido"})
+		return
+	}
+	if walletID := c.Query("wallet_id"); walletID != "" {
+		query = query.Where("wallet_id = ?", walletID)
+	}
+	for _, d := range []struct {
+		param, cond string
+	}{{"from_date", "created_at >= ?"}, {"to_date", "created_at <= ?"}} {
+		raw := c.Query(d.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Data inválida em " + d.param + ", use RFC3339 (ex: 2025-01-31T23:59:59-03:00)"})
+			return
+		}
+		query = query.Where(d.cond, t.UTC())
+	}
+	var codes []models.QRCode
+	if err := query.Order("created_at desc").Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao carregar QR Codes"})
+		return
+	}
+
+	ids := make([]uint, len(codes))
+	for i, qr := range codes {
+		ids[i] = qr.ID
+	}
+	// Payers may pay from another currency, what the code received is the converted amount
+	var totals []struct {
+		QRCodeID uint
+		Payments int64
+		Received float64
+	}
+	if len(ids) > 0 {
+		err := config.DB.Model(&models.Transaction{}).
+			Select("qr_code_id, COUNT(*) AS payments, SUM(COALESCE(converted_amount, amount)) AS received").
+			Where("qr_code_id IN ? AND type = ?", ids, models.TransactionTypeTransfer).
+			Group("qr_code_id").Scan(&totals).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao carregar QR Codes"})
+			return
+		}
+	}
+	byCode := make(map[uint]int)
+	for i, t := range totals {
+		byCode[t.QRCodeID] = i
+	}
+
+	result := make([]gin.H, len(codes))
+	for i, qr := range codes {
+		item := gin.H{
+			"id":           qr.ID,
+			"token":        qr.Token,
+			"type":         qr.Type,
+			"status":       qrStatus(&qr),
+			"amount":       qr.Amount,
+			"currency":     qr.Currency,
+			"wallet_id":    qr.WalletID,
+			"use_count":    qr.UseCount,
+			"max_uses":     qr.MaxUses,
+			"created_at":   qr.CreatedAt,
+			"expires_at":   formatExpiry(qr.ExpiresAt),
+			"cancelled_at": formatExpiry(qr.CancelledAt),
+			"image_url":    "/api/qr/" + qr.Token + "/image",
+			"payments":     int64(0),
+			"received":     0.0,
+		}
+		if j, ok := byCode[qr.ID]; ok {
+			item["payments"] = totals[j].Payments
+			item["received"] = totals[j].Received
+		}
+		result[i] = item
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CancelQR stops an active QR code from accepting new payments. Past payments are untouched.
+func CancelQR(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var qr models.QRCode
+	if err := config.DB.Where("token = ? AND user_id = ?", c.Param("token"), userID).First(&qr).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR Code não encontrado"})
+		return
+	}
+	if qrStatus(&qr) != models.QRStatusActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Só é possível cancelar QR Codes ativos"})
+		return
+	}
+	now := time.Now().UTC()
+	// Conditional so a payment using up the code at the same time wins over the cancel
+	result := config.DB.Model(&models.QRCode{}).Where("id = ? AND status = ?", qr.ID, models.QRStatusActive).
+		Updates(map[string]interface{}{"status": models.QRStatusCancelled, "cancelled_at": now})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao cancelar QR Code"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Só é possível cancelar QR Codes ativos"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "QR Code cancelado"})
+}
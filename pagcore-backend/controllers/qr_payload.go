@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Santannafe12/pagcore-backend/brcode"
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	qrPayloadGUI        = "br.com.pagcore" // Identifies our arrangement in the merchant account field
+	qrTokenLength       = 25               // Fills the BR Code txid, about 148 bits of randomness
+	defaultMerchantCity = "SAO PAULO"
+	// The Ed25519 signature doesn't fit a single template (values are capped at 99 chars),
+	// so it is split across two: 80 holds the expiry and the first half, 81 the second half.
+	qrSignatureTag     = "80"
+	qrSignatureTailTag = "81"
+	qrBackfillBatch    = 500
+)
+
+var errQRSignature = errors.New("qr payload signature is invalid")
+
+const tokenAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomToken returns an unguessable alphanumeric token, as BR Code txids only allow [A-Za-z0-9].
+func randomToken(n int) (string, error) {
+	token := make([]byte, n)
+	max := big.NewInt(int64(len(tokenAlphabet)))
+	for i := range token {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		token[i] = tokenAlphabet[idx.Int64()]
+	}
+	return string(token), nil
+}
+
+// qrSignedMessage is what the signature covers. Clients verifying offline rebuild it from the
+// payload as "token|recipient key|amount with two decimals or empty|currency|expiry unix or 0".
+func qrSignedMessage(token, recipient string, amount *float64, currency string, expiresAt int64) []byte {
+	amountStr := ""
+	if amount != nil {
+		amountStr = strconv.FormatFloat(*amount, 'f', 2, 64)
+	}
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%d", token, recipient, amountStr, currency, expiresAt))
+}
+
+// encodeQRPayload builds the signed EMV BR Code for a QR code. Fixed amount codes carry the
+// amount, open amount codes leave it for the payer, and the txid holds the QR token.
+func encodeQRPayload(qr *models.QRCode, owner *models.User) (string, error) {
+	city := os.Getenv("QR_MERCHANT_CITY")
+	if city == "" {
+		city = defaultMerchantCity
+	}
+	p := brcode.Payload{
+		Initiation:   brcode.InitiationStatic,
+		GUI:          qrPayloadGUI,
+		Key:          owner.Username,
+		Currency:     qr.Currency,
+		MerchantName: displayName(owner),
+		MerchantCity: city,
+		TxID:         qr.Token,
+	}
+	if qr.Type == models.QRTypeSingleUse {
+		p.Initiation = brcode.InitiationDynamic
+	}
+	if qr.Type != models.QRTypeOpenAmount {
+		amount := qr.Amount
+		p.Amount = &amount
+	}
+	var expiresAt int64
+	if qr.ExpiresAt != nil {
+		expiresAt = qr.ExpiresAt.Unix()
+	}
+	sig := ed25519.Sign(config.QRSigningKey, qrSignedMessage(qr.Token, owner.Username, p.Amount, qr.Currency, expiresAt))
+	encodedSig := base64.RawURLEncoding.EncodeToString(sig)
+	half := len(encodedSig) / 2
+	p.Extensions = []brcode.Extension{
+		{Tag: qrSignatureTag, GUI: qrPayloadGUI, Fields: map[string]string{
+			"01": strconv.FormatInt(expiresAt, 10),
+			"02": encodedSig[:half],
+		}},
+		{Tag: qrSignatureTailTag, GUI: qrPayloadGUI, Fields: map[string]string{"01": encodedSig[half:]}},
+	}
+	return p.Encode()
+}
+
+// BackfillQRPayloads gives the QR codes created before payloads were stored their signed BR
+// Code. Codes created before tokens existed get one first, so the payload can be redeemed and the
+// code found through /qr/:token. Codes that still don't fit a BR Code are skipped. It returns
+// how many were filled.
+func BackfillQRPayloads() (int64, error) {
+	var filled int64
+	var lastID uint
+	for {
+		var batch []models.QRCode
+		err := config.DB.Where("(payload IS NULL OR payload = '') AND id > ?", lastID).Order("id").Limit(qrBackfillBatch).Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return filled, err
+		}
+		for i := range batch {
+			qr := &batch[i]
+			lastID = qr.ID
+			var owner models.User
+			if err := config.DB.First(&owner, qr.UserID).Error; err != nil {
+				return filled, err
+			}
+			if qr.Token == "" {
+				if qr.Token, err = randomToken(qrTokenLength); err != nil {
+					return filled, err
+				}
+			}
+			payload, err := encodeQRPayload(qr, &owner)
+			if err != nil {
+				fmt.Printf("Skipping payload of QR code %d: %v\n", qr.ID, err)
+				continue
+			}
+			if err := config.DB.Model(qr).Updates(map[string]interface{}{"token": qr.Token, "payload": payload}).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+}
+
+// decodeQRPayload parses a BR Code, checks it was signed by us and returns the QR token.
+func decodeQRPayload(raw string) (brcode.Payload, string, error) {
+	p, err := brcode.Parse(raw)
+	if err != nil {
+		return p, "", err
+	}
+	if p.GUI != qrPayloadGUI || p.TxID == "" {
+		return p, "", errors.New("qr payload was not issued by pagcore")
+	}
+	var head, tail brcode.Extension
+	for _, ext := range p.Extensions {
+		switch ext.Tag {
+		case qrSignatureTag:
+			head = ext
+		case qrSignatureTailTag:
+			tail = ext
+		}
+	}
+	if head.GUI != qrPayloadGUI || tail.GUI != qrPayloadGUI {
+		return p, "", errQRSignature
+	}
+	expiresAt, err := strconv.ParseInt(head.Fields["01"], 10, 64)
+	if err != nil {
+		return p, "", errQRSignature
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(head.Fields["02"] + tail.Fields["01"])
+	if err != nil {
+		return p, "", errQRSignature
+	}
+	publicKey := config.QRSigningKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, qrSignedMessage(p.TxID, p.Key, p.Amount, p.Currency, expiresAt), sig) {
+		return p, "", errQRSignature
+	}
+	return p, p.TxID, nil
+}
+
+// payloadMatchesQR rejects payloads whose terms no longer match the stored code.
+func payloadMatchesQR(p *brcode.Payload, qr *models.QRCode) bool {
+	if p.Currency != qr.Currency || p.Key != qr.User.Username {
+		return false
+	}
+	if qr.Type == models.QRTypeOpenAmount {
+		return p.Amount == nil
+	}
+	return p.Amount != nil && toCents(*p.Amount) == toCents(qr.Amount)
+}
+
+// GetQRPublicKey exposes the key clients use to verify QR payloads before calling the API.
+func GetQRPublicKey(c *gin.Context) {
+	publicKey := config.QRSigningKey.Public().(ed25519.PublicKey)
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "Ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(publicKey),
+		"message":    "token|recipient|amount|currency|expires_at",
+	})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/pdf"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReceiptVerifyBaseURL = "http://localhost:3000/receipts/"
+	receiptCodeGroups           = 4
+)
+
+var receiptTypeLabels = map[models.TransactionType]string{
+	models.TransactionTypeTransfer:   "Transferência",
+	models.TransactionTypeDeposit:    "Depósito",
+	models.TransactionTypeRefund:     "Estorno",
+	models.TransactionTypeInternal:   "Movimentação entre carteiras",
+	models.TransactionTypeFee:        "Tarifa",
+	models.TransactionTypeSettlement: "Liquidação",
+}
+
+// receiptVerifyURL is the page where anyone can check a receipt, configured with
+// RECEIPT_VERIFY_BASE_URL.
+func receiptVerifyURL(code string) string {
+	base := os.Getenv("RECEIPT_VERIFY_BASE_URL")
+	if base == "" {
+		base = defaultReceiptVerifyBaseURL
+	}
+	return base + code
+}
+
+// newReceiptCode makes an authentication code like 7KQ2-M4XD-HP3A-ZW9C, 80 random bits.
+func newReceiptCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return groupReceiptCode(base32.StdEncoding.EncodeToString(raw)), nil
+}
+
+func groupReceiptCode(s string) string {
+	var groups []string
+	for len(s) > receiptCodeGroups {
+		groups = append(groups, s[:receiptCodeGroups])
+		s = s[receiptCodeGroups:]
+	}
+	return strings.Join(append(groups, s), "-")
+}
+
+// normalizeReceiptCode accepts codes typed in lower case or without dashes.
+func normalizeReceiptCode(s string) string {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "", ".", "").Replace(s))
+	return groupReceiptCode(s)
+}
+
+// ensureAuthCode gives the transaction its authentication code the first time a receipt is
+// issued. The update only applies while there is none, so concurrent requests agree on one.
+func ensureAuthCode(t *models.Transaction) error {
+	if t.AuthCode != nil {
+		return nil
+	}
+	code, err := newReceiptCode()
+	if err != nil {
+		return err
+	}
+	if err := config.DB.Model(&models.Transaction{}).Where("id = ? AND auth_code IS NULL", t.ID).
+		Update("auth_code", code).Error; err != nil {
+		return err
+	}
+	return config.DB.Select("auth_code").First(t, t.ID).Error
+}
+
+// maskCPF keeps the middle digits of a CPF, like ***.456.789-**.
+func maskCPF(cpf string) string {
+	digits := onlyDigits(cpf)
+	if len(digits) != 11 {
+		return ""
+	}
+	return fmt.Sprintf("***.%s.%s-**", digits[3:6], digits[6:9])
+}
+
+func formatCNPJ(cnpj string) string {
+	if len(cnpj) != 14 {
+		return cnpj
+	}
+	return fmt.Sprintf("%s.%s.%s/%s-%s", cnpj[:2], cnpj[2:5], cnpj[5:8], cnpj[8:12], cnpj[12:])
+}
+
+// receiptParty is what a receipt shows about one side: the name and a document that identifies
+// it without exposing a person's full CPF.
+func receiptParty(user *models.User) gin.H {
+	party := gin.H{"name": displayName(user)}
+	if user.AccountType == models.AccountTypeMerchant {
+		var profile models.MerchantProfile
+		if config.DB.Where("user_id = ?", user.ID).Limit(1).Find(&profile); profile.CNPJ != "" {
+			party["document"] = formatCNPJ(profile.CNPJ)
+		}
+	} else if user.CPF != nil {
+		if masked := maskCPF(*user.CPF); masked != "" {
+			party["document"] = masked
+		}
+	}
+	return party
+}
+
+func receiptTitle(t *models.Transaction) string {
+	switch {
+	case t.QRCodeID != nil:
+		return "Pagamento via QR Code"
+	case t.PaymentLinkID != nil:
+		return "Pagamento de link"
+	case t.PaymentRequestID != nil:
+		return "Pagamento de solicitação"
+	}
+	if label, ok := receiptTypeLabels[t.Type]; ok {
+		return label
+	}
+	return string(t.Type)
+}
+
+func receiptData(t *models.Transaction) gin.H {
+	receipt := gin.H{
+		"auth_code":      *t.AuthCode,
+		"transaction_id": t.ID,
+		"title":          receiptTitle(t),
+		"type":           t.Type,
+		"status":         t.Status,
+		"date":           t.CreatedAt,
+		"amount":         t.Amount,
+		"currency":       t.Currency,
+		"fee":            t.Fee,
+		"description":    t.Description,
+		"payer":          receiptParty(&t.Sender),
+		"payee":          receiptParty(&t.Recipient),
+		"verify_url":     receiptVerifyURL(*t.AuthCode),
+	}
+	if t.ConvertedAmount != nil {
+		receipt["converted_amount"] = *t.ConvertedAmount
+		receipt["converted_currency"] = t.ConvertedCurrency
+		receipt["fx_rate"] = t.FXRate
+	}
+	return receipt
+}
+
+// GetReceipt issues the receipt of a transaction of the user, as JSON or with format=pdf.
+func GetReceipt(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != exportPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato inválido, use json ou pdf"})
+		return
+	}
+	var t models.Transaction
+	err := config.DB.Preload("Sender").Preload("Recipient").
+		Where("id = ? AND (sender_id = ? OR recipient_id = ?)", c.Param("transaction_id"), userID, userID).
+		First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transação não encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao gerar comprovante"})
+		return
+	}
+	if t.Status != models.TransactionStatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transação não concluída"})
+		return
+	}
+	if err := ensureAuthCode(&t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao gerar comprovante"})
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, receiptData(&t))
+		return
+	}
+	startExport(c, exportPDF, fmt.Sprintf("comprovante-%d", t.ID))
+	if err := writeReceiptPDF(c.Writer, &t); err != nil {
+		fmt.Printf("Failed to write receipt of transaction %d: %v\n", t.ID, err)
+		c.Abort()
+	}
+}
+
+func writeReceiptPDF(w gin.ResponseWriter, t *models.Transaction) error {
+	doc := pdf.New(w, "Comprovante")
+	doc.Text(pdf.HelveticaBold, 16, "Comprovante - "+receiptTitle(t))
+	doc.Text(pdf.Helvetica, 10, t.CreatedAt.In(invoiceZone).Format("02/01/2006 às 15:04:05")+" (horário de Brasília)")
+	doc.Rule()
+	doc.Space(6)
+	doc.Text(pdf.HelveticaBold, 12, "Valor: "+formatMoney(t.Amount, t.Currency))
+	if t.ConvertedAmount != nil {
+		doc.Text(pdf.Helvetica, 10, fmt.Sprintf("Creditado: %s (câmbio %.6f)", formatMoney(*t.ConvertedAmount, t.ConvertedCurrency), *t.FXRate))
+	}
+	if t.Fee > 0 {
+		doc.Text(pdf.Helvetica, 10, "Tarifa: "+formatMoney(t.Fee, t.Currency))
+	}
+	if t.Description != "" {
+		doc.Text(pdf.Helvetica, 10, "Descrição: "+t.Description)
+	}
+	for _, side := range []struct {
+		label string
+		user  *models.User
+	}{{"De", &t.Sender}, {"Para", &t.Recipient}} {
+		doc.Space(8)
+		party := receiptParty(side.user)
+		doc.Text(pdf.HelveticaBold, 11, side.label)
+		doc.Text(pdf.Helvetica, 10, "Nome: "+party["name"].(string))
+		if document, ok := party["document"].(string); ok {
+			doc.Text(pdf.Helvetica, 10, "Documento: "+document)
+		}
+	}
+	doc.Space(8)
+	doc.Rule()
+	doc.Text(pdf.Helvetica, 10, fmt.Sprintf("ID da transação: %d", t.ID))
+	doc.Text(pdf.HelveticaBold, 11, "Autenticação: "+*t.AuthCode)
+	doc.Text(pdf.Helvetica, 9, "Confira a autenticidade em "+receiptVerifyURL(*t.AuthCode))
+	return doc.Close()
+}
+
+// VerifyReceipt confirms, without login, that an authentication code belongs to a real
+// transaction, showing just enough to compare with the receipt in hand.
+func VerifyReceipt(c *gin.Context) {
+	code := normalizeReceiptCode(c.Param("code"))
+	var t models.Transaction
+	err := config.DB.Preload("Sender").Preload("Recipient").Where("auth_code = ?", code).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"valid": false, "error": "Comprovante não encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao verificar comprovante"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"valid":          true,
+		"auth_code":      code,
+		"transaction_id": t.ID,
+		"title":          receiptTitle(&t),
+		"status":         t.Status,
+		"date":           t.CreatedAt,
+		"amount":         t.Amount,
+		"currency":       t.Currency,
+		"payer":          receiptParty(&t.Sender),
+		"payee":          receiptParty(&t.Recipient),
+	})
+}
@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	statementMonthLayout = "2006-01"
+	statementCloseBatch  = 100
+)
+
+// monthStart is the first instant of the Brasília calendar month t falls in.
+func monthStart(t time.Time) time.Time {
+	local := t.In(invoiceZone)
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, invoiceZone)
+}
+
+// walletNet is what entered minus what left the wallet in [from, to). A nil to means up to now.
+func walletNet(tx *gorm.DB, walletID uint, from time.Time, to *time.Time) (float64, error) {
+	query := tx.Model(&models.Transaction{}).
+		Select("COALESCE(SUM(CASE WHEN recipient_wallet_id = ? THEN COALESCE(converted_amount, amount) ELSE 0 END), 0) - "+
+			"COALESCE(SUM(CASE WHEN sender_wallet_id = ? THEN amount ELSE 0 END), 0)", walletID, walletID).
+		Where("(sender_wallet_id = ? OR recipient_wallet_id = ?) AND status = ?", walletID, walletID, models.TransactionStatusCompleted).
+		Where("created_at >= ?", from)
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	var net float64
+	err := query.Scan(&net).Error
+	return fromCents(toCents(net)), err
+}
+
+// balanceAt is the wallet balance right before t. It starts from the last closed statement when
+// there is one, otherwise it walks back from the current balance, so wallet must have been read
+// under lockWalletForStatement or in the same REPEATABLE READ snapshot as tx.
+func balanceAt(tx *gorm.DB, wallet *models.Wallet, t time.Time) (float64, error) {
+	var closed models.Statement
+	if err := tx.Where("wallet_id = ? AND period_end <= ?", wallet.ID, t).Order("period_end desc").Limit(1).Find(&closed).Error; err != nil {
+		return 0, err
+	}
+	if closed.ID != 0 {
+		net, err := walletNet(tx, wallet.ID, closed.PeriodEnd, &t)
+		return fromCents(toCents(closed.ClosingBalance) + toCents(net)), err
+	}
+	net, err := walletNet(tx, wallet.ID, t, nil)
+	return fromCents(toCents(wallet.Balance) - toCents(net)), err
+}
+
+// lockWalletForStatement rereads the wallet holding a share lock, so no movement commits between
+// reading its balance and summing its history.
+func lockWalletForStatement(tx *gorm.DB, wallet *models.Wallet) error {
+	return tx.Clauses(clause.Locking{Strength: "SHARE"}).First(wallet, wallet.ID).Error
+}
+
+// signedAmount is how a transaction moved the wallet, positive when money came in.
+func signedAmount(t *models.Transaction, walletID uint) float64 {
+	if t.RecipientWalletID != nil && *t.RecipientWalletID == walletID {
+		if t.ConvertedAmount != nil {
+			return *t.ConvertedAmount
+		}
+		return t.Amount
+	}
+	return -t.Amount
+}
+
+// buildStatement works out the statement of [start, end) from the transaction history. Run it
+// inside a transaction.
+func buildStatement(tx *gorm.DB, wallet *models.Wallet, start, end time.Time) (models.Statement, error) {
+	s := models.Statement{
+		WalletID:    wallet.ID,
+		UserID:      wallet.UserID,
+		Currency:    wallet.Currency,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+	if err := lockWalletForStatement(tx, wallet); err != nil {
+		return s, err
+	}
+	opening, err := balanceAt(tx, wallet, start)
+	if err != nil {
+		return s, err
+	}
+	var txs []models.Transaction
+	err = tx.Preload("Sender").Preload("Recipient").
+		Where("(sender_wallet_id = ? OR recipient_wallet_id = ?) AND status = ?", wallet.ID, wallet.ID, models.TransactionStatusCompleted).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Order("created_at, id").Find(&txs).Error
+	if err != nil {
+		return s, err
+	}
+	s.OpeningBalance = opening
+	balance := toCents(opening)
+	var credits, debits int64
+	for i := range txs {
+		t := &txs[i]
+		amount := toCents(signedAmount(t, wallet.ID))
+		balance += amount
+		counterparty := &t.Sender
+		if amount < 0 {
+			debits -= amount
+			counterparty = &t.Recipient
+		} else {
+			credits += amount
+		}
+		s.Lines = append(s.Lines, models.StatementLine{
+			TransactionID: t.ID,
+			PostedAt:      t.CreatedAt,
+			Type:          t.Type,
+			Description:   t.Description,
+			Counterparty:  displayName(counterparty),
+			Amount:        fromCents(amount),
+			Balance:       fromCents(balance),
+		})
+	}
+	s.ClosingBalance = fromCents(balance)
+	s.TotalCredits = fromCents(credits)
+	s.TotalDebits = fromCents(debits)
+	return s, nil
+}
+
+func statementResponse(s *models.Statement, closed bool) gin.H {
+	movements := make([]gin.H, len(s.Lines))
+	for i, l := range s.Lines {
+		movements[i] = gin.H{
+			"transaction_id": l.TransactionID,
+			"date":           l.PostedAt,
+			"type":           l.Type,
+			"description":    l.Description,
+			"counterparty":   l.Counterparty,
+			"amount":         l.Amount,
+			"balance":        l.Balance,
+		}
+	}
+	response := gin.H{
+		"wallet_id":       s.WalletID,
+		"currency":        s.Currency,
+		"period_start":    s.PeriodStart,
+		"period_end":      s.PeriodEnd,
+		"opening_balance": s.OpeningBalance,
+		"closing_balance": s.ClosingBalance,
+		"total_credits":   s.TotalCredits,
+		"total_debits":    s.TotalDebits,
+		"movements":       movements,
+		"closed":          closed,
+	}
+	if closed {
+		response["closed_at"] = s.ClosedAt
+	}
+	return response
+}
+
+// statementPeriod reads the period of a statement: month (YYYY-MM, Brasília time) or from_date
+// and to_date in RFC3339, to_date exclusive and defaulting to now. The message is for the user.
+func statementPeriod(c *gin.Context, now time.Time) (start, end time.Time, month bool, msg string) {
+	if raw := c.Query("month"); raw != "" {
+		t, err := time.ParseInLocation(statementMonthLayout, raw, invoiceZone)
+		if err != nil {
+			return start, end, true, "Mês inválido, use AAAA-MM"
+		}
+		start, end = t, t.AddDate(0, 1, 0)
+		month = true
+	} else {
+		raw := c.Query("from_date")
+		if raw == "" {
+			return start, end, false, "Informe month ou from_date"
+		}
+		var err error
+		if start, err = time.Parse(time.RFC3339, raw); err != nil {
+			return start, end, false, "Data inválida em from_date, use RFC3339"
+		}
+		end = now
+		if raw := c.Query("to_date"); raw != "" {
+			if end, err = time.Parse(time.RFC3339, raw); err != nil {
+				return start, end, false, "Data inválida em to_date, use RFC3339"
+			}
+		}
+	}
+	if !start.Before(now) {
+		return start, end, month, "O período ainda não começou"
+	}
+	if !end.After(start) {
+		return start, end, month, "to_date deve ser depois de from_date"
+	}
+	if end.After(now) {
+		end = now
+	}
+	return start.UTC(), end.UTC(), month, ""
+}
+
+// loadStatement reads the wallet (wallet_id, default wallet otherwise) and period of a statement
+// request and returns its statement, from the snapshot when the month is closed. On failure it
+// has already answered.
+func loadStatement(c *gin.Context) (*models.Statement, *models.Wallet, bool, bool) {
+	userID := c.GetUint("user_id")
+	var walletID *uint
+	if raw := c.Query("wallet_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Carteira inválida"})
+			return nil, nil, false, false
+		}
+		walletIDValue := uint(id)
+		walletID = &walletIDValue
+	}
+	wallet, err := resolveWallet(config.DB, userID, walletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao gerar extrato")
+		return nil, nil, false, false
+	}
+	start, end, month, msg := statementPeriod(c, time.Now().UTC())
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return nil, nil, false, false
+	}
+	if month {
+		var closed models.Statement
+		config.DB.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Where("wallet_id = ? AND period_start = ?", wallet.ID, start).Limit(1).Find(&closed)
+		if closed.ID != 0 {
+			return &closed, &wallet, true, true
+		}
+	}
+	var statement models.Statement
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		statement, err = buildStatement(tx, &wallet, start, end)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao gerar extrato"})
+		return nil, nil, false, false
+	}
+	return &statement, &wallet, false, true
+}
+
+// GetStatement returns the statement of a wallet for a period: opening balance, every movement
+// with the running balance and the closing balance. Closed months come from their snapshot.
+func GetStatement(c *gin.Context) {
+	statement, _, closed, ok := loadStatement(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, statementResponse(statement, closed))
+}
+
+// GetClosedStatements lists the closed months of the user's wallets, without their movements.
+func GetClosedStatements(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	query := config.DB.Where("user_id = ?", userID)
+	if walletID := c.Query("wallet_id"); walletID != "" {
+		query = query.Where("wallet_id = ?", walletID)
+	}
+	var statements []models.Statement
+	if err := query.Order("period_start desc, wallet_id").Find(&statements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar extratos"})
+		return
+	}
+	items := make([]gin.H, len(statements))
+	for i := range statements {
+		s := &statements[i]
+		items[i] = gin.H{
+			"wallet_id":       s.WalletID,
+			"currency":        s.Currency,
+			"month":           s.PeriodStart.In(invoiceZone).Format(statementMonthLayout),
+			"opening_balance": s.OpeningBalance,
+			"closing_balance": s.ClosingBalance,
+			"total_credits":   s.TotalCredits,
+			"total_debits":    s.TotalDebits,
+			"closed_at":       s.ClosedAt,
+		}
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// CloseStatements snapshots every month that ended since a wallet's last closed statement.
+// It runs as a background job with its own transactions, one per wallet, so the share locks
+// statements take are only held for that wallet's months. A wallet that fails doesn't keep the
+// others from closing. It returns how many statements were closed.
+func CloseStatements(db *gorm.DB) (int64, error) {
+	current := monthStart(time.Now().UTC())
+	var wallets []models.Wallet
+	err := db.Where("created_at < ?", current).
+		Where("NOT EXISTS (SELECT 1 FROM statements s WHERE s.wallet_id = wallets.id AND s.period_start = ?)", current.AddDate(0, -1, 0).UTC()).
+		Order("id").Limit(statementCloseBatch).Find(&wallets).Error
+	if err != nil {
+		return 0, err
+	}
+	var closed int64
+	var firstErr error
+	for i := range wallets {
+		n, err := closeWalletStatements(db, &wallets[i], current)
+		if err != nil {
+			fmt.Printf("Failed to close statements of wallet %d: %v\n", wallets[i].ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		closed += n
+	}
+	return closed, firstErr
+}
+
+// closeWalletStatements closes the wallet's months before current in one transaction.
+func closeWalletStatements(db *gorm.DB, wallet *models.Wallet, current time.Time) (int64, error) {
+	var closed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var last models.Statement
+		if err := tx.Where("wallet_id = ?", wallet.ID).Order("period_end desc").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		start := monthStart(wallet.CreatedAt)
+		if last.ID != 0 {
+			start = last.PeriodEnd.In(invoiceZone)
+		}
+		for start.Before(current) {
+			end := start.AddDate(0, 1, 0)
+			statement, err := buildStatement(tx, wallet, start.UTC(), end.UTC())
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&statement).Error; err != nil {
+				return err
+			}
+			closed++
+			start = end
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return closed, nil
+}
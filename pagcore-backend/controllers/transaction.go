@@ -1,19 +1,72 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Santannafe12/pagcore-backend/config"
 	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TransferInput struct {
-	RecipientUsername string  `json:"recipient_username" binding:"required"`
-	Amount            float64 `json:"amount" binding:"required,gt=0"`
+	RecipientUsername string  `json:"recipient_username" binding:"required_without=QuoteID"`
+	Amount            float64 `json:"amount" binding:"required_without=QuoteID,omitempty,gt=0"` // In the sender wallet currency
 	Description       string  `json:"description"`
+	FromWalletID      *uint   `json:"from_wallet_id"` // Defaults to the sender's default wallet
+	ToWalletID        *uint   `json:"to_wallet_id"`   // Defaults to the recipient's default wallet
+	QuoteID           string  `json:"quote_id"`       // From POST /transfer/quote, overrides the fields above
+}
+
+var (
+	errRecipientNotFound = errors.New("recipient not found")
+	errQuoteUsed         = errors.New("transfer quote already used")
+)
+
+// transferPlan is a validated transfer, priced but not yet executed.
+type transferPlan struct {
+	Sender      models.User
+	Recipient   models.User
+	FromWallet  models.Wallet
+	ToWallet    models.Wallet
+	Move        exchange
+	Fee         float64
+	Description string
+}
+
+// planTransfer runs every validation of a transfer without moving money.
+func planTransfer(tx *gorm.DB, userID uint, input TransferInput) (transferPlan, error) {
+	plan := transferPlan{Description: input.Description}
+	if err := tx.First(&plan.Sender, userID).Error; err != nil {
+		return plan, err
+	}
+	tx.Where("username = ?", input.RecipientUsername).First(&plan.Recipient)
+	if plan.Recipient.ID == 0 {
+		return plan, errRecipientNotFound
+	}
+	var err error
+	if plan.FromWallet, err = resolveWallet(tx, plan.Sender.ID, input.FromWalletID); err != nil {
+		return plan, err
+	}
+	if plan.ToWallet, err = resolveWallet(tx, plan.Recipient.ID, input.ToWalletID); err != nil {
+		return plan, err
+	}
+	if plan.Move, err = priceDebit(&plan.FromWallet, &plan.ToWallet, input.Amount); err != nil {
+		return plan, err
+	}
+	if plan.Fee, err = quoteFee(tx, models.FeeTransactionTransfer, &plan.Sender, &plan.FromWallet, plan.Move.Debit); err != nil {
+		return plan, err
+	}
+	if toCents(plan.FromWallet.Balance) < toCents(plan.Move.Debit)+toCents(plan.Fee) {
+		return plan, errInsufficientFunds
+	}
+	return plan, nil
 }
 
 func MakeTransfer(c *gin.Context) {
@@ -23,60 +76,103 @@ func MakeTransfer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	var sender, recipient models.User
-	config.DB.First(&sender, userID)
-	config.DB.Where("username = ?", input.RecipientUsername).First(&recipient)
-	if recipient.ID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Destinatário não encontrado"})
-		return
-	}
-	if sender.Balance < input.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo insuficiente"})
-		return
+	var quote *transferQuoteClaims
+	if input.QuoteID != "" {
+		var err error
+		if quote, err = parseTransferQuote(input.QuoteID, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cotação inválida ou expirada"})
+			return
+		}
+		input = quote.input()
 	}
+	var txRecord models.Transaction
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
-		sender.Balance -= input.Amount
-		recipient.Balance += input.Amount
-		if err := tx.Save(&sender).Error; err != nil {
+		plan, err := planTransfer(tx, userID, input)
+		if err != nil {
 			return err
 		}
-		if err := tx.Save(&recipient).Error; err != nil {
+		if quote != nil {
+			// Honor the quoted rate and fee even if rates or schedules changed since
+			plan.Move = quote.move()
+			plan.Fee = quote.Fee
+		}
+		if err := moveBalance(tx, &plan.FromWallet, &plan.ToWallet, plan.Move); err != nil {
 			return err
 		}
-		txRecord := models.Transaction{
-			SenderID:    sender.ID,
-			RecipientID: recipient.ID,
-			Amount:      input.Amount,
-			Description: input.Description,
+		txRecord = models.Transaction{
+			SenderID:    plan.Sender.ID,
+			RecipientID: plan.Recipient.ID,
+			Description: plan.Description,
 			Type:        models.TransactionTypeTransfer,
 		}
-		return tx.Create(&txRecord).Error
+		if quote != nil {
+			txRecord.QuoteID = &quote.ID
+		}
+		plan.Move.record(&txRecord, &plan.FromWallet, &plan.ToWallet)
+		create := tx
+		if quote != nil {
+			// A quote is honored once, a second transfer with it inserts nothing and rolls back
+			create = tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "quote_id"}}, DoNothing: true})
+		}
+		result := create.Create(&txRecord)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errQuoteUsed
+		}
+		if err := outbox.Publish(tx, transferReceived(plan.Recipient.ID, &txRecord, &plan.Sender)); err != nil {
+			return err
+		}
+		if err := notifyTransferReceived(tx, models.NotificationTransferReceived, plan.Recipient.ID, &txRecord, &plan.Sender); err != nil {
+			return err
+		}
+		return postFee(tx, &plan.Sender, &plan.FromWallet, &txRecord, plan.Fee)
 	})
+	if errors.Is(err, errRecipientNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destinatário não encontrado"})
+		return
+	}
+	if errors.Is(err, errQuoteUsed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cotação já utilizada"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao transferir"})
+		walletErrorResponse(c, err, "Erro ao transferir")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Sucesso ao transferir"})
+	c.JSON(http.StatusOK, gin.H{"message": "Sucesso ao transferir", "transaction_id": txRecord.ID})
 }
 
+// GetTransactionHistory pages through the user's transactions, newest first. Filters: from_date and
+// to_date (RFC3339), type, status, direction (sent, received), counterparty (username),
+// min_amount, max_amount and q (description search). Pass next_cursor back as cursor for the next page.
 func GetTransactionHistory(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	fromDate := c.Query("from_date") // e.g., "2025-01-01"
-	toDate := c.Query("to_date")     // e.g., "2025-12-31"
-	typeFilter := c.Query("type")    // e.g., "transfer"
-
-	query := config.DB.Preload("Sender").Preload("Recipient").
-		Where("sender_id = ? OR recipient_id = ?", userID, userID)
-	if fromDate != "" {
-		query = query.Where("created_at >= ?", fromDate)
+	filter, msg := parseTxFilter(c, userID)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(historyPageSize)))
+	if err != nil || limit < 1 || limit > historyMaxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit deve estar entre 1 e %d", historyMaxPageSize)})
+		return
 	}
-	if toDate != "" {
-		query = query.Where("created_at <= ?", toDate)
+	page, err := findTxPage(filter, c.Query("cursor"), limit)
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cursor inválido"})
+		return
 	}
-	if typeFilter != "" {
-		query = query.Where("type = ?", typeFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar transações"})
+		return
 	}
-	var txs []models.Transaction
-	query.Order("created_at desc").Find(&txs)
-	c.JSON(http.StatusOK, txs)
+	c.JSON(http.StatusOK, gin.H{
+		"items":       page.Items,
+		"total":       page.Total,
+		"limit":       limit,
+		"has_more":    page.NextCursor != "",
+		"next_cursor": page.NextCursor,
+	})
 }
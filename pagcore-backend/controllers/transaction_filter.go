@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	historyPageSize    = 50
+	historyMaxPageSize = 200
+	dashboardRecentTx  = 10
+	exportBatchSize    = 500
+)
+
+var (
+	transactionTypes = map[models.TransactionType]bool{
+		models.TransactionTypeTransfer:   true,
+		models.TransactionTypeDeposit:    true,
+		models.TransactionTypeRefund:     true,
+		models.TransactionTypeInternal:   true,
+		models.TransactionTypeFee:        true,
+		models.TransactionTypeSettlement: true,
+	}
+	transactionStatuses = map[models.TransactionStatus]bool{
+		models.TransactionStatusCompleted: true,
+		models.TransactionStatusPending:   true,
+		models.TransactionStatusFailed:    true,
+	}
+	errInvalidCursor = errors.New("invalid cursor")
+)
+
+// txFilter is what a user can narrow their transactions down to. History, statements and
+// exports share it so the same query string means the same rows everywhere.
+type txFilter struct {
+	UserID         uint
+	WalletID       uint
+	From, To       *time.Time
+	Type           models.TransactionType
+	Status         models.TransactionStatus
+	Direction      string // sent or received
+	CounterpartyID uint
+	MinAmount      *float64
+	MaxAmount      *float64
+	Search         string
+}
+
+// parseTxFilter reads the filters from the query string. The returned message is meant for
+// the user.
+func parseTxFilter(c *gin.Context, userID uint) (txFilter, string) {
+	f := txFilter{UserID: userID}
+	for _, d := range []struct {
+		param string
+		dst   **time.Time
+	}{{"from_date", &f.From}, {"to_date", &f.To}} {
+		raw := c.Query(d.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return f, "Data inválida em " + d.param + ", use RFC3339 (ex: 2025-01-31T23:59:59-03:00)"
+		}
+		t = t.UTC()
+		*d.dst = &t
+	}
+	if f.From != nil && f.To != nil && f.To.Before(*f.From) {
+		return f, "to_date deve ser depois de from_date"
+	}
+	if raw := c.Query("wallet_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return f, "Carteira inválida"
+		}
+		walletID := uint(id)
+		wallet, err := resolveWallet(config.DB, userID, &walletID)
+		if err != nil {
+			return f, "Carteira não encontrada"
+		}
+		f.WalletID = wallet.ID
+	}
+	if raw := c.Query("type"); raw != "" {
+		f.Type = models.TransactionType(raw)
+		if !transactionTypes[f.Type] {
+			return f, "Tipo de transação inválido"
+		}
+	}
+	if raw := c.Query("status"); raw != "" {
+		f.Status = models.TransactionStatus(raw)
+		if !transactionStatuses[f.Status] {
+			return f, "Status inválido"
+		}
+	}
+	switch f.Direction = c.Query("direction"); f.Direction {
+	case "", "sent", "received":
+	default:
+		return f, "Direção inválida, use sent ou received"
+	}
+	if username := c.Query("counterparty"); username != "" {
+		var counterparty models.User
+		if config.DB.Where("username = ?", username).Limit(1).Find(&counterparty).RowsAffected == 0 {
+			return f, "Contraparte não encontrada"
+		}
+		f.CounterpartyID = counterparty.ID
+	}
+	for _, a := range []struct {
+		param string
+		dst   **float64
+	}{{"min_amount", &f.MinAmount}, {"max_amount", &f.MaxAmount}} {
+		raw := c.Query(a.param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return f, "Valor inválido em " + a.param
+		}
+		*a.dst = &v
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && *f.MaxAmount < *f.MinAmount {
+		return f, "max_amount deve ser maior que min_amount"
+	}
+	f.Search = strings.TrimSpace(c.Query("q"))
+	return f, ""
+}
+
+// apply narrows a query on transactions down to the filter.
+func (f txFilter) apply(query *gorm.DB) *gorm.DB {
+	switch {
+	case f.Direction == "sent" && f.CounterpartyID != 0:
+		query = query.Where("sender_id = ? AND recipient_id = ?", f.UserID, f.CounterpartyID)
+	case f.Direction == "received" && f.CounterpartyID != 0:
+		query = query.Where("recipient_id = ? AND sender_id = ?", f.UserID, f.CounterpartyID)
+	case f.Direction == "sent":
+		query = query.Where("sender_id = ?", f.UserID)
+	case f.Direction == "received":
+		query = query.Where("recipient_id = ?", f.UserID)
+	case f.CounterpartyID != 0:
+		query = query.Where("((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))",
+			f.UserID, f.CounterpartyID, f.CounterpartyID, f.UserID)
+	default:
+		query = query.Where("(sender_id = ? OR recipient_id = ?)", f.UserID, f.UserID)
+	}
+	if f.WalletID != 0 {
+		query = query.Where("(sender_wallet_id = ? OR recipient_wallet_id = ?)", f.WalletID, f.WalletID)
+	}
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at <= ?", *f.To)
+	}
+	if f.Type != "" {
+		query = query.Where("type = ?", f.Type)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.MinAmount != nil {
+		query = query.Where("amount >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		query = query.Where("amount <= ?", *f.MaxAmount)
+	}
+	if f.Search != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Search)
+		query = query.Where("description ILIKE ?", "%"+escaped+"%")
+	}
+	return query
+}
+
+// txCursor points right after the last transaction of a page, newest first.
+type txCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+func encodeTxCursor(t *models.Transaction) string {
+	raw, _ := json.Marshal(txCursor{CreatedAt: t.CreatedAt, ID: t.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeTxCursor(s string) (txCursor, error) {
+	var cur txCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &cur) != nil || cur.ID == 0 {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+type txPage struct {
+	Items      []models.Transaction
+	Total      int64
+	NextCursor string
+}
+
+// findTxPage loads one page of the filtered transactions, newest first, after the cursor.
+func findTxPage(f txFilter, cursor string, limit int) (txPage, error) {
+	var page txPage
+	if err := f.apply(config.DB.Model(&models.Transaction{})).Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+	query := f.apply(config.DB.Preload("Sender").Preload("Recipient"))
+	if cursor != "" {
+		cur, err := decodeTxCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", cur.CreatedAt, cur.ID)
+	}
+	if err := query.Order("created_at desc, id desc").Limit(limit + 1).Find(&page.Items).Error; err != nil {
+		return page, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextCursor = encodeTxCursor(&page.Items[limit-1])
+	}
+	return page, nil
+}
+
+// eachTx calls fn for every filtered transaction, oldest first, loading them in batches so
+// exports of any size run in constant memory.
+func eachTx(f txFilter, fn func(t *models.Transaction) error) error {
+	var cur *txCursor
+	for {
+		query := f.apply(config.DB.Preload("Sender").Preload("Recipient"))
+		if cur != nil {
+			query = query.Where("(created_at, id) > (?, ?)", cur.CreatedAt, cur.ID)
+		}
+		var batch []models.Transaction
+		if err := query.Order("created_at, id").Limit(exportBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		last := &batch[len(batch)-1]
+		cur = &txCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// userAmount is how a transaction moved the filtered wallet, or the user's money when no wallet
+// was picked, with the currency it moved in. Positive when money came in. Moving money between
+// one's own wallets leaves the user's money as it was, so it is zero without a wallet.
+func (f txFilter) userAmount(t *models.Transaction) (float64, string) {
+	credit := t.RecipientID == f.UserID
+	if f.WalletID != 0 {
+		credit = t.RecipientWalletID != nil && *t.RecipientWalletID == f.WalletID
+	} else if t.SenderID == t.RecipientID {
+		return 0, t.Currency
+	}
+	if !credit {
+		return -t.Amount, t.Currency
+	}
+	if t.ConvertedAmount != nil {
+		return *t.ConvertedAmount, t.ConvertedCurrency
+	}
+	return t.Amount, t.Currency
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	transferQuoteTTL      = 2 * time.Minute
+	transferQuoteAudience = "transfer_quote" // Keeps quotes and session tokens from being swapped
+)
+
+// transferQuoteClaims pins everything a transfer needs, so executing a quote can't change its terms.
+type transferQuoteClaims struct {
+	UserID            uint     `json:"user_id"`
+	RecipientUsername string   `json:"recipient_username"`
+	FromWalletID      uint     `json:"from_wallet_id"`
+	ToWalletID        uint     `json:"to_wallet_id"`
+	Amount            float64  `json:"amount"`
+	Credit            float64  `json:"credit"`
+	Rate              *float64 `json:"rate,omitempty"`
+	Fee               float64  `json:"fee"`
+	Description       string   `json:"description"`
+	jwt.RegisteredClaims
+}
+
+func (q *transferQuoteClaims) input() TransferInput {
+	return TransferInput{
+		RecipientUsername: q.RecipientUsername,
+		Amount:            q.Amount,
+		Description:       q.Description,
+		FromWalletID:      &q.FromWalletID,
+		ToWalletID:        &q.ToWalletID,
+	}
+}
+
+func (q *transferQuoteClaims) move() exchange {
+	return exchange{Debit: q.Amount, Credit: q.Credit, Rate: q.Rate}
+}
+
+func signTransferQuote(userID uint, plan transferPlan) (string, time.Time, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().UTC().Add(transferQuoteTTL)
+	claims := transferQuoteClaims{
+		UserID:            userID,
+		RecipientUsername: plan.Recipient.Username,
+		FromWalletID:      plan.FromWallet.ID,
+		ToWalletID:        plan.ToWallet.ID,
+		Amount:            plan.Move.Debit,
+		Credit:            plan.Move.Credit,
+		Rate:              plan.Move.Rate,
+		Fee:               plan.Fee,
+		Description:       plan.Description,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(nonce),
+			Audience:  jwt.ClaimStrings{transferQuoteAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return token, expiresAt, err
+}
+
+func parseTransferQuote(tokenStr string, userID uint) (*transferQuoteClaims, error) {
+	claims := &transferQuoteClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	}, jwt.WithAudience(transferQuoteAudience), jwt.WithExpirationRequired(), jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID != userID || claims.ID == "" {
+		return nil, errors.New("quote belongs to another user")
+	}
+	return claims, nil
+}
+
+// maskName keeps the first name and reduces the others to initials, e.g. "Maria S. O.".
+func maskName(fullName string) string {
+	parts := strings.Fields(fullName)
+	if len(parts) == 0 {
+		return ""
+	}
+	masked := []string{parts[0]}
+	for _, p := range parts[1:] {
+		r, _ := utf8.DecodeRuneInString(p)
+		masked = append(masked, string(r)+".")
+	}
+	return strings.Join(masked, " ")
+}
+
+// recipientName masks people's names, merchants are shown by trade name.
+func recipientName(user *models.User) string {
+	if user.AccountType == models.AccountTypeMerchant {
+		return displayName(user)
+	}
+	return maskName(user.FullName)
+}
+
+// QuoteTransfer validates a transfer like MakeTransfer does, without moving money, and returns
+// a signed quote that MakeTransfer honors through quote_id until it expires.
+func QuoteTransfer(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input TransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.QuoteID != "" || input.RecipientUsername == "" || input.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destinatário e valor são obrigatórios"})
+		return
+	}
+	plan, err := planTransfer(config.DB, userID, input)
+	if errors.Is(err, errRecipientNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destinatário não encontrado"})
+		return
+	}
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao calcular cotação")
+		return
+	}
+	quoteID, expiresAt, err := signTransferQuote(userID, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao calcular cotação"})
+		return
+	}
+	totalCents := toCents(plan.Move.Debit) + toCents(plan.Fee)
+	response := gin.H{
+		"quote_id":           quoteID,
+		"expires_at":         expiresAt.Format(time.RFC3339),
+		"recipient":          plan.Recipient.Username,
+		"recipient_name":     recipientName(&plan.Recipient),
+		"amount":             plan.Move.Debit,
+		"fee":                plan.Fee,
+		"total":              fromCents(totalCents),
+		"currency":           plan.FromWallet.Currency,
+		"balance_after":      fromCents(toCents(plan.FromWallet.Balance) - totalCents),
+		"recipient_amount":   plan.Move.Credit,
+		"recipient_currency": plan.ToWallet.Currency,
+	}
+	if plan.Move.Rate != nil {
+		response["fx_rate"] = *plan.Move.Rate
+	}
+	if plan.FromWallet.Currency == models.BaseCurrency {
+		response["total_balance_after"] = fromCents(toCents(plan.Sender.Balance) - totalCents)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -54,15 +54,24 @@ func GetDashboard(c *gin.Context) {
 	var user models.User
 	config.DB.First(&user, userID)
 
-	var recentTx []models.Transaction
-	config.DB.Where("sender_id = ? OR recipient_id = ?", userID, userID).
-		Preload("Sender").Preload("Recipient").
-		Order("created_at desc").Find(&recentTx)
+	wallets := []models.Wallet{}
+	if _, err := defaultWallet(config.DB, userID); err == nil {
+		config.DB.Where("user_id = ?", userID).Order("is_default desc, name").Find(&wallets)
+	}
+
+	recent, _ := findTxPage(txFilter{UserID: userID}, "", dashboardRecentTx)
+
+	var unread int64
+	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_id":             user.ID,
-		"full_name":           user.FullName,
-		"balance":             user.Balance,
-		"recent_transactions": recentTx,
+		"user_id":              user.ID,
+		"full_name":            user.FullName,
+		"balance":              user.Balance,
+		"wallets":              wallets,
+		"recent_transactions":  recent.Items,
+		"transaction_count":    recent.Total,
+		"next_cursor":          recent.NextCursor, // Continues in /transactions?cursor=
+		"unread_notifications": unread,
 	})
 }
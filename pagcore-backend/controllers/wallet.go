@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/fx"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errInsufficientFunds = errors.New("insufficient funds")
+	errWalletNotFound    = errors.New("wallet not found")
+	errCurrencyMismatch  = errors.New("receiving wallet currency changed")
+)
+
+// defaultWallet returns the user's default wallet. Users created before wallets existed
+// get one on first access, seeded with their current balance.
+func defaultWallet(tx *gorm.DB, userID uint) (models.Wallet, error) {
+	var wallet models.Wallet
+	err := tx.Where("user_id = ? AND is_default = ?", userID, true).First(&wallet).Error
+	if err == nil {
+		return wallet, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return wallet, err
+	}
+	var count int64
+	if err := tx.Model(&models.Wallet{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return wallet, err
+	}
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return wallet, err
+	}
+	wallet = models.Wallet{UserID: userID, Name: models.DefaultWalletName, Currency: models.BaseCurrency, IsDefault: true}
+	if count == 0 {
+		wallet.Balance = user.Balance
+	}
+	return wallet, tx.Create(&wallet).Error
+}
+
+// resolveWallet returns the given wallet of the user, or the default one when walletID is nil.
+func resolveWallet(tx *gorm.DB, userID uint, walletID *uint) (models.Wallet, error) {
+	if walletID == nil {
+		return defaultWallet(tx, userID)
+	}
+	var wallet models.Wallet
+	if err := tx.Where("id = ? AND user_id = ?", *walletID, userID).First(&wallet).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return wallet, errWalletNotFound
+		}
+		return wallet, err
+	}
+	return wallet, nil
+}
+
+// receivingWallet resolves the wallet a QR code or payment request pays into. If that wallet
+// was removed in the meantime, the default wallet is used as long as it holds the same currency.
+func receivingWallet(tx *gorm.DB, userID uint, walletID *uint, currency string) (models.Wallet, error) {
+	wallet, err := resolveWallet(tx, userID, walletID)
+	if errors.Is(err, errWalletNotFound) {
+		wallet, err = defaultWallet(tx, userID)
+	}
+	if err != nil {
+		return wallet, err
+	}
+	if wallet.Currency != currency {
+		return wallet, errCurrencyMismatch
+	}
+	return wallet, nil
+}
+
+// exchange describes what leaves one wallet and what lands in another.
+type exchange struct {
+	Debit  float64  // In the source wallet currency
+	Credit float64  // In the destination wallet currency
+	Rate   *float64 // Effective FX rate, nil when both wallets share a currency
+}
+
+// priceDebit prices a move where the amount taken from the source wallet is fixed.
+func priceDebit(from, to *models.Wallet, amount float64) (exchange, error) {
+	if from.Currency == to.Currency {
+		return exchange{Debit: amount, Credit: amount}, nil
+	}
+	conv, err := config.FX.Convert(amount, from.Currency, to.Currency)
+	if err != nil {
+		return exchange{}, err
+	}
+	return exchange{Debit: conv.Amount, Credit: conv.Converted, Rate: &conv.Rate}, nil
+}
+
+// priceCredit prices a move where the amount delivered to the destination wallet is fixed.
+func priceCredit(from, to *models.Wallet, amount float64) (exchange, error) {
+	if from.Currency == to.Currency {
+		return exchange{Debit: amount, Credit: amount}, nil
+	}
+	conv, err := config.FX.Cost(amount, from.Currency, to.Currency)
+	if err != nil {
+		return exchange{}, err
+	}
+	return exchange{Debit: conv.Amount, Credit: conv.Converted, Rate: &conv.Rate}, nil
+}
+
+// record fills the money fields of a transaction from the exchange.
+func (e exchange) record(t *models.Transaction, from, to *models.Wallet) {
+	t.SenderWalletID = &from.ID
+	t.RecipientWalletID = &to.ID
+	t.Amount = e.Debit
+	t.Currency = from.Currency
+	if e.Rate != nil {
+		credit := e.Credit
+		t.ConvertedAmount = &credit
+		t.ConvertedCurrency = to.Currency
+		t.FXRate = e.Rate
+	}
+}
+
+// moveBalance applies an exchange inside tx, keeping User.Balance in sync with BRL wallets.
+// The debit is conditional so concurrent payments can't overdraw a wallet.
+func moveBalance(tx *gorm.DB, from, to *models.Wallet, e exchange) error {
+	result := tx.Model(&models.Wallet{}).Where("id = ? AND balance >= ?", from.ID, e.Debit).
+		Update("balance", gorm.Expr("balance - ?", e.Debit))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientFunds
+	}
+	if err := tx.Model(&models.Wallet{}).Where("id = ?", to.ID).
+		Update("balance", gorm.Expr("balance + ?", e.Credit)).Error; err != nil {
+		return err
+	}
+	if from.Currency == models.BaseCurrency {
+		if err := tx.Model(&models.User{}).Where("id = ?", from.UserID).
+			Update("balance", gorm.Expr("balance - ?", e.Debit)).Error; err != nil {
+			return err
+		}
+	}
+	if to.Currency == models.BaseCurrency {
+		if err := tx.Model(&models.User{}).Where("id = ?", to.UserID).
+			Update("balance", gorm.Expr("balance + ?", e.Credit)).Error; err != nil {
+			return err
+		}
+	}
+	from.Balance -= e.Debit
+	to.Balance += e.Credit
+	if err := publishBalanceChanged(tx, from); err != nil {
+		return err
+	}
+	return publishBalanceChanged(tx, to)
+}
+
+// publishBalanceChanged records the wallet balance as of this transaction for real-time clients.
+func publishBalanceChanged(tx *gorm.DB, wallet *models.Wallet) error {
+	var balance float64
+	if err := tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Select("balance").Scan(&balance).Error; err != nil {
+		return err
+	}
+	return outbox.Publish(tx, outbox.Event{
+		Type:        outbox.EventBalanceChanged,
+		UserID:      wallet.UserID,
+		Aggregate:   outbox.AggregateWallet,
+		AggregateID: wallet.ID,
+		Data: gin.H{
+			"wallet_id": wallet.ID,
+			"currency":  wallet.Currency,
+			"balance":   balance,
+		},
+	})
+}
+
+// walletErrorResponse maps wallet helper errors to the API response.
+func walletErrorResponse(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, errInsufficientFunds):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo insuficiente"})
+	case errors.Is(err, errWalletNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Carteira não encontrada"})
+	case errors.Is(err, errCurrencyMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "A carteira de destino não aceita mais essa moeda"})
+	case errors.Is(err, fx.ErrRateUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cotação indisponível para essa moeda"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func GetWallets(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if _, err := defaultWallet(config.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao carregar carteiras"})
+		return
+	}
+	var wallets []models.Wallet
+	config.DB.Where("user_id = ?", userID).Order("is_default desc, name").Find(&wallets)
+	c.JSON(http.StatusOK, wallets)
+}
+
+type CreateWalletInput struct {
+	Name     string `json:"name" binding:"required,max=50"`
+	Currency string `json:"currency" binding:"omitempty,iso4217"` // Defaults to BRL
+}
+
+func CreateWallet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input CreateWalletInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Make sure the legacy balance lands in the default wallet before adding pockets
+	if _, err := defaultWallet(config.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar carteira"})
+		return
+	}
+	var count int64
+	config.DB.Model(&models.Wallet{}).Where("user_id = ? AND name = ?", userID, input.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Já existe uma carteira com esse nome"})
+		return
+	}
+	currency := models.BaseCurrency
+	if input.Currency != "" {
+		currency = input.Currency
+	}
+	wallet := models.Wallet{UserID: userID, Name: input.Name, Currency: currency}
+	if err := config.DB.Create(&wallet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar carteira"})
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+func SetDefaultWallet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Carteira inválida"})
+		return
+	}
+	walletID := uint(id)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		wallet, err := resolveWallet(tx, userID, &walletID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Wallet{}).Where("user_id = ?", userID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&wallet).Update("is_default", true).Error
+	})
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao definir carteira padrão")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Carteira padrão atualizada"})
+}
+
+func DeleteWallet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Carteira inválida"})
+		return
+	}
+	walletID := uint(id)
+	wallet, err := resolveWallet(config.DB, userID, &walletID)
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao remover carteira")
+		return
+	}
+	if wallet.IsDefault || wallet.Balance != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Só é possível remover carteiras vazias que não sejam a padrão"})
+		return
+	}
+	// Checked again in the delete itself, a payment may have landed since the wallet was read
+	result := config.DB.Where("id = ? AND balance = 0 AND is_default = false", wallet.ID).Delete(&models.Wallet{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover carteira"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A carteira recebeu saldo ou virou a padrão, tente novamente"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Carteira removida"})
+}
+
+type MoveBetweenWalletsInput struct {
+	FromWalletID uint    `json:"from_wallet_id" binding:"required"`
+	ToWalletID   uint    `json:"to_wallet_id" binding:"required"`
+	Amount       float64 `json:"amount" binding:"required,gt=0"`
+	Description  string  `json:"description"`
+}
+
+// MoveBetweenWallets moves money between two wallets of the same user, free of charge.
+func MoveBetweenWallets(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input MoveBetweenWalletsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.FromWalletID == input.ToWalletID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Carteiras de origem e destino devem ser diferentes"})
+		return
+	}
+	var txRecord models.Transaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		from, err := resolveWallet(tx, userID, &input.FromWalletID)
+		if err != nil {
+			return err
+		}
+		to, err := resolveWallet(tx, userID, &input.ToWalletID)
+		if err != nil {
+			return err
+		}
+		move, err := priceDebit(&from, &to, input.Amount)
+		if err != nil {
+			return err
+		}
+		if err := moveBalance(tx, &from, &to, move); err != nil {
+			return err
+		}
+		txRecord = models.Transaction{
+			SenderID:    userID,
+			RecipientID: userID,
+			Description: input.Description,
+			Type:        models.TransactionTypeInternal,
+		}
+		move.record(&txRecord, &from, &to)
+		return tx.Create(&txRecord).Error
+	})
+	if err != nil {
+		walletErrorResponse(c, err, "Falha ao mover saldo")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Saldo movido", "transaction_id": txRecord.ID})
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+	"github.com/Santannafe12/pagcore-backend/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebhookEndpointInput struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required,min=1"`
+	Active *bool    `json:"active"`
+}
+
+// validate checks the URL and events and returns the events as stored on the endpoint.
+func (input WebhookEndpointInput) validate() (string, bool) {
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	for _, e := range input.Events {
+		if !webhooks.ValidEvent(e) {
+			return "", false
+		}
+	}
+	return strings.Join(input.Events, ","), true
+}
+
+func webhookEndpointResponse(e *models.WebhookEndpoint) gin.H {
+	return gin.H{
+		"id":         e.ID,
+		"url":        e.URL,
+		"events":     strings.Split(e.Events, ","),
+		"active":     e.Active,
+		"created_at": e.CreatedAt,
+	}
+}
+
+// CreateWebhookEndpoint registers an endpoint. The signing secret is only returned here.
+func CreateWebhookEndpoint(c *gin.Context) {
+	var input WebhookEndpointInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, ok := input.validate()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL ou eventos inválidos", "events": webhooks.Events})
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar webhook"})
+		return
+	}
+	endpoint := models.WebhookEndpoint{UserID: c.GetUint("user_id"), URL: input.URL, Secret: secret, Events: events, Active: true}
+	if input.Active != nil {
+		endpoint.Active = *input.Active
+	}
+	if err := config.DB.Create(&endpoint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar webhook"})
+		return
+	}
+	response := webhookEndpointResponse(&endpoint)
+	response["secret"] = secret
+	c.JSON(http.StatusOK, response)
+}
+
+func GetWebhookEndpoints(c *gin.Context) {
+	var endpoints []models.WebhookEndpoint
+	config.DB.Where("user_id = ?", c.GetUint("user_id")).Order("created_at").Find(&endpoints)
+	result := make([]gin.H, len(endpoints))
+	for i := range endpoints {
+		result[i] = webhookEndpointResponse(&endpoints[i])
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func findWebhookEndpoint(c *gin.Context) (models.WebhookEndpoint, bool) {
+	var endpoint models.WebhookEndpoint
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("webhook_id"), c.GetUint("user_id")).First(&endpoint).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado"})
+		return endpoint, false
+	}
+	return endpoint, true
+}
+
+func UpdateWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := findWebhookEndpoint(c)
+	if !ok {
+		return
+	}
+	var input WebhookEndpointInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, ok := input.validate()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL ou eventos inválidos", "events": webhooks.Events})
+		return
+	}
+	endpoint.URL = input.URL
+	endpoint.Events = events
+	if input.Active != nil {
+		endpoint.Active = *input.Active
+	}
+	if err := config.DB.Save(&endpoint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, webhookEndpointResponse(&endpoint))
+}
+
+func DeleteWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := findWebhookEndpoint(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", endpoint.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&endpoint).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook removido"})
+}
+
+// PingWebhookEndpoint queues a webhook.ping event, handy to test a local receiver.
+func PingWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := findWebhookEndpoint(c)
+	if !ok {
+		return
+	}
+	id, err := webhooks.NewEventID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao enviar teste"})
+		return
+	}
+	ping := webhooks.Event{ID: id, Type: webhooks.EventPing, CreatedAt: time.Now().UTC(), Data: gin.H{"endpoint_id": endpoint.ID}}
+	if err := webhooks.EnqueueTo(config.DB, &endpoint, ping); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao enviar teste"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Teste enviado"})
+}
+
+// GetWebhookDeliveries lists recent deliveries to the user's endpoints. status=dead gives the
+// dead-letter list.
+func GetWebhookDeliveries(c *gin.Context) {
+	query := config.DB.Joins("Endpoint").Where("\"Endpoint\".user_id = ?", c.GetUint("user_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("webhook_deliveries.status = ?", status)
+	}
+	if endpointID := c.Query("endpoint_id"); endpointID != "" {
+		query = query.Where("webhook_deliveries.endpoint_id = ?", endpointID)
+	}
+	var deliveries []models.WebhookDelivery
+	query.Order("webhook_deliveries.created_at desc").Limit(100).Find(&deliveries)
+	result := make([]gin.H, len(deliveries))
+	for i, d := range deliveries {
+		result[i] = gin.H{
+			"id":               d.ID,
+			"endpoint_id":      d.EndpointID,
+			"event_id":         d.EventID,
+			"event_type":       d.EventType,
+			"payload":          d.Payload,
+			"status":           d.Status,
+			"attempts":         d.Attempts,
+			"next_attempt_at":  d.NextAttemptAt,
+			"last_status_code": d.LastStatusCode,
+			"last_error":       d.LastError,
+			"delivered_at":     d.DeliveredAt,
+			"created_at":       d.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RedeliverWebhook queues a delivery again with the same event, e.g. from the dead-letter list.
+// Receivers can use the event id to drop duplicates.
+func RedeliverWebhook(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	err := config.DB.Joins("Endpoint").Where("webhook_deliveries.id = ? AND \"Endpoint\".user_id = ?", c.Param("delivery_id"), c.GetUint("user_id")).
+		First(&delivery).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entrega não encontrada"})
+		return
+	}
+	if delivery.Status == models.WebhookDeliveryPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Entrega já está na fila"})
+		return
+	}
+	err = config.DB.Model(&delivery).Updates(map[string]interface{}{
+		"status":          models.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now().UTC(),
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao reenviar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Entrega reenfileirada"})
+}
+
+// transferEventData describes money arriving to the recipient, in the recipient's currency.
+func transferEventData(t *models.Transaction, sender *models.User) gin.H {
+	amount, currency := t.Amount, t.Currency
+	if t.ConvertedAmount != nil {
+		amount, currency = *t.ConvertedAmount, t.ConvertedCurrency
+	}
+	return gin.H{
+		"transaction_id":     t.ID,
+		"amount":             amount,
+		"currency":           currency,
+		"sender":             sender.Username,
+		"sender_name":        displayName(sender),
+		"description":        t.Description,
+		"qr_code_id":         t.QRCodeID,
+		"payment_request_id": t.PaymentRequestID,
+		"payment_link_id":    t.PaymentLinkID,
+		"created_at":         t.CreatedAt,
+	}
+}
+
+// transferReceived is the event for money landing in the recipient's account.
+func transferReceived(recipientID uint, t *models.Transaction, sender *models.User) outbox.Event {
+	return outbox.Event{
+		Type:        outbox.EventTransferReceived,
+		UserID:      recipientID,
+		Aggregate:   outbox.AggregateUser,
+		AggregateID: recipientID,
+		Data:        transferEventData(t, sender),
+	}
+}
+
+func invoiceOrNil(isInvoice bool, invoice *models.Invoice) *models.Invoice {
+	if !isInvoice {
+		return nil
+	}
+	return invoice
+}
+
+// paymentRequestEvent describes a payment request change for the given user.
+func paymentRequestEvent(eventType string, userID uint, req *models.PaymentRequest, invoice *models.Invoice) outbox.Event {
+	data := gin.H{
+		"payment_request_id": req.ID,
+		"requester_id":       req.RequesterID,
+		"payer_id":           req.PayerID,
+		"amount":             req.Amount,
+		"amount_paid":        req.AmountPaid,
+		"currency":           req.Currency,
+		"description":        req.Description,
+		"status":             req.Status,
+		"expires_at":         formatExpiry(req.ExpiresAt),
+	}
+	if invoice != nil {
+		data["invoice_id"] = invoice.ID
+		data["due_date"] = invoice.DueDate.Format(invoiceDateLayout)
+	}
+	return outbox.Event{
+		Type:        eventType,
+		UserID:      userID,
+		Aggregate:   outbox.AggregatePaymentRequest,
+		AggregateID: req.ID,
+		Data:        data,
+	}
+}
@@ -0,0 +1,118 @@
+// Package events wakes up real-time streams when outbox events for their user are published.
+// The relay sends a Postgres NOTIFY with the user ID, and every replica LISTENs and wakes its
+// local subscribers, which then read the new events from the outbox.
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+const Channel = "pagcore_events"
+
+var (
+	mu       sync.Mutex
+	subs     = make(map[uint]map[chan struct{}]struct{})
+	watchers []func(userID uint)
+)
+
+// Watch calls fn every time a user has new events, on every replica. Register watchers before
+// Listen.
+func Watch(fn func(userID uint)) {
+	watchers = append(watchers, fn)
+}
+
+// Subscribe returns a channel that receives a signal whenever the user has new events.
+// Signals coalesce, so readers should fetch everything after their last event. Call cancel
+// when done.
+func Subscribe(userID uint) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	mu.Lock()
+	if subs[userID] == nil {
+		subs[userID] = make(map[chan struct{}]struct{})
+	}
+	subs[userID][ch] = struct{}{}
+	mu.Unlock()
+	return ch, func() {
+		mu.Lock()
+		delete(subs[userID], ch)
+		if len(subs[userID]) == 0 {
+			delete(subs, userID)
+		}
+		mu.Unlock()
+	}
+}
+
+func wake(userID uint) {
+	for _, fn := range watchers {
+		fn(userID)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range subs[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// NotifySink is the outbox sink behind the streams. The NOTIFY is only delivered once the
+// relay transaction commits, together with the publish_seq the streams follow.
+type NotifySink struct{}
+
+func (NotifySink) Name() string { return "notify" }
+
+func (NotifySink) Publish(tx *gorm.DB, e *models.OutboxEvent) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", Channel, strconv.FormatUint(uint64(e.UserID), 10)).Error
+}
+
+// Listen holds a dedicated connection LISTENing on Channel and wakes local subscribers,
+// reconnecting when the connection drops. It needs a direct, non pooled Postgres endpoint.
+func Listen(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("Failed to start event listener: " + err.Error())
+	}
+	go func() {
+		for {
+			if err := listen(sqlDB); err != nil {
+				fmt.Println("Event listener stopped:", err)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+func listen(sqlDB *sql.DB) error {
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+Channel); err != nil {
+			return err
+		}
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			if userID, err := strconv.ParseUint(n.Payload, 10, 32); err == nil {
+				wake(uint(userID))
+			}
+		}
+	})
+}
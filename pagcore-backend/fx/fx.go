@@ -0,0 +1,125 @@
+// Package fx converts amounts between currencies using rates from a pluggable RateProvider.
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrRateUnavailable = errors.New("fx: rate unavailable")
+
+// RateProvider returns how many units of `to` one unit of `from` buys.
+type RateProvider interface {
+	Rate(from, to string) (float64, error)
+}
+
+// MemoryProvider keeps rates in memory, keyed as "FROM/TO". The inverse pair is derived when missing.
+type MemoryProvider struct {
+	mu    sync.RWMutex
+	rates map[string]float64
+}
+
+func NewMemoryProvider(rates map[string]float64) *MemoryProvider {
+	p := &MemoryProvider{rates: make(map[string]float64)}
+	for pair, rate := range rates {
+		p.rates[strings.ToUpper(pair)] = rate
+	}
+	return p
+}
+
+func (p *MemoryProvider) Set(from, to string, rate float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rates[pairKey(from, to)] = rate
+}
+
+func (p *MemoryProvider) Rate(from, to string) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if rate, ok := p.rates[pairKey(from, to)]; ok && rate > 0 {
+		return rate, nil
+	}
+	if rate, ok := p.rates[pairKey(to, from)]; ok && rate > 0 {
+		return 1 / rate, nil
+	}
+	return 0, ErrRateUnavailable
+}
+
+// LoadStaticFile reads a JSON object of rates such as {"USD/BRL": 5.40, "EUR/BRL": 5.90}.
+func LoadStaticFile(path string) (*MemoryProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates map[string]float64
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, err
+	}
+	return NewMemoryProvider(rates), nil
+}
+
+func pairKey(from, to string) string {
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
+
+// Conversion records what was converted and at which rates.
+type Conversion struct {
+	From       string
+	To         string
+	Amount     float64 // In From currency
+	Converted  float64 // In To currency
+	MarketRate float64 // Rate returned by the provider
+	Rate       float64 // Effective rate after the spread
+}
+
+// Converter applies a spread (e.g. 0.01 for 1%) against the customer on top of provider rates.
+type Converter struct {
+	Provider RateProvider
+	Spread   float64
+}
+
+func (c Converter) effectiveRate(from, to string) (float64, float64, error) {
+	if c.Provider == nil {
+		return 0, 0, ErrRateUnavailable
+	}
+	market, err := c.Provider.Rate(from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if strings.EqualFold(from, to) {
+		return market, market, nil
+	}
+	return market, market * (1 - c.Spread), nil
+}
+
+// Convert prices a fixed amount in `from` currency.
+func (c Converter) Convert(amount float64, from, to string) (Conversion, error) {
+	market, rate, err := c.effectiveRate(from, to)
+	if err != nil {
+		return Conversion{}, err
+	}
+	return Conversion{From: from, To: to, Amount: amount, Converted: round2(amount * rate), MarketRate: market, Rate: rate}, nil
+}
+
+// Cost returns how much `from` currency is needed to deliver a fixed amount in `to` currency.
+func (c Converter) Cost(converted float64, from, to string) (Conversion, error) {
+	market, rate, err := c.effectiveRate(from, to)
+	if err != nil {
+		return Conversion{}, err
+	}
+	// Round up to the cent so the recipient is never short
+	micros := int64(math.Round(converted / rate * 1e6))
+	amount := float64((micros+9999)/10000) / 100
+	return Conversion{From: from, To: to, Amount: amount, Converted: converted, MarketRate: market, Rate: rate}, nil
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,95 @@
+package fx
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConverterConvert(t *testing.T) {
+	rates := NewMemoryProvider(map[string]float64{"usd/brl": 5.40, "EUR/BRL": 5.00})
+	tests := []struct {
+		name          string
+		converter     Converter
+		amount        float64
+		from, to      string
+		wantConverted float64
+		wantRate      float64
+		wantErr       error
+	}{
+		{"direct pair", Converter{Provider: rates}, 100, "USD", "BRL", 540, 5.40, nil},
+		{"spread against the customer", Converter{Provider: rates, Spread: 0.01}, 100, "USD", "BRL", 534.60, 5.346, nil},
+		{"inverse pair", Converter{Provider: rates}, 100, "BRL", "EUR", 20, 0.2, nil},
+		{"case insensitive", Converter{Provider: rates}, 10, "usd", "brl", 54, 5.40, nil},
+		{"same currency has no spread", Converter{Provider: rates, Spread: 0.01}, 10, "BRL", "brl", 10, 1, nil},
+		{"rounds to the cent", Converter{Provider: rates}, 0.333, "USD", "BRL", 1.80, 5.40, nil},
+		{"unknown pair", Converter{Provider: rates}, 10, "USD", "JPY", 0, 0, ErrRateUnavailable},
+		{"no provider", Converter{}, 10, "USD", "BRL", 0, 0, ErrRateUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.converter.Convert(tt.amount, tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Converted != tt.wantConverted {
+				t.Errorf("Converted = %v, want %v", got.Converted, tt.wantConverted)
+			}
+			if math.Abs(got.Rate-tt.wantRate) > 1e-9 {
+				t.Errorf("Rate = %v, want %v", got.Rate, tt.wantRate)
+			}
+			if got.Amount != tt.amount {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.amount)
+			}
+		})
+	}
+}
+
+func TestConverterCost(t *testing.T) {
+	rates := NewMemoryProvider(map[string]float64{"USD/BRL": 5.00})
+	tests := []struct {
+		name       string
+		converter  Converter
+		converted  float64
+		from, to   string
+		wantAmount float64
+		wantErr    error
+	}{
+		{"exact", Converter{Provider: rates}, 100, "USD", "BRL", 20, nil},
+		{"rounds up so the recipient is never short", Converter{Provider: rates, Spread: 0.01}, 100, "USD", "BRL", 20.21, nil},
+		{"inverse pair", Converter{Provider: rates}, 20, "BRL", "USD", 100, nil},
+		{"same currency", Converter{Provider: rates, Spread: 0.01}, 12.34, "BRL", "BRL", 12.34, nil},
+		{"unknown pair", Converter{Provider: rates}, 10, "EUR", "BRL", 0, ErrRateUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.converter.Cost(tt.converted, tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Amount != tt.wantAmount {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.wantAmount)
+			}
+			if round2(got.Amount*got.Rate) < tt.converted {
+				t.Errorf("%v at %v delivers less than %v", got.Amount, got.Rate, tt.converted)
+			}
+		})
+	}
+}
+
+func TestMemoryProviderSet(t *testing.T) {
+	p := NewMemoryProvider(nil)
+	if _, err := p.Rate("USD", "BRL"); !errors.Is(err, ErrRateUnavailable) {
+		t.Fatalf("err = %v, want ErrRateUnavailable", err)
+	}
+	p.Set("usd", "brl", 5.5)
+	if rate, err := p.Rate("USD", "BRL"); err != nil || rate != 5.5 {
+		t.Fatalf("Rate = %v, %v, want 5.5", rate, err)
+	}
+}
@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ExpirePaymentLinks marks active payment links past their expiry date as expired.
+func ExpirePaymentLinks(tx *gorm.DB) (int64, error) {
+	result := tx.Model(&models.PaymentLink{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", models.PaymentLinkStatusActive, time.Now().UTC()).
+		Update("status", models.PaymentLinkStatusExpired)
+	return result.RowsAffected, result.Error
+}
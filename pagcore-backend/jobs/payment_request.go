@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ExpirePaymentRequests marks open payment requests past their expiry date as expired,
+// and closes the split groups left with no participant that can still pay.
+func ExpirePaymentRequests(tx *gorm.DB) (int64, error) {
+	openStatuses := []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusPartiallyPaid}
+	result := tx.Model(&models.PaymentRequest{}).
+		Where("status IN ? AND expires_at IS NOT NULL AND expires_at < ?", openStatuses, time.Now().UTC()).
+		Update("status", models.PaymentStatusExpired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	err := tx.Model(&models.PaymentGroup{}).
+		Where("status = ?", models.PaymentGroupStatusOpen).
+		Where("NOT EXISTS (SELECT 1 FROM payment_requests WHERE payment_requests.group_id = payment_groups.id AND payment_requests.status IN ?)", openStatuses).
+		Where("EXISTS (SELECT 1 FROM payment_requests WHERE payment_requests.group_id = payment_groups.id AND payment_requests.status = ?)", models.PaymentStatusExpired).
+		Update("status", models.PaymentGroupStatusClosed).Error
+	return result.RowsAffected, err
+}
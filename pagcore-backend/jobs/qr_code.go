@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ExpireQRCodes marks active QR codes past their expiry date as expired.
+func ExpireQRCodes(tx *gorm.DB) (int64, error) {
+	result := tx.Model(&models.QRCode{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", models.QRStatusActive, time.Now().UTC()).
+		Update("status", models.QRStatusExpired)
+	return result.RowsAffected, result.Error
+}
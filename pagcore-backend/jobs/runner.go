@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/config"
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Job is a periodic task. Run gets a transaction holding the job's advisory lock and returns
+// how many rows it changed.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(tx *gorm.DB) (int64, error)
+	// OwnTransactions jobs get the plain connection pool instead and open short transactions
+	// of their own, for work that calls out to the network or touches many rows. The advisory
+	// lock is still held for the whole run.
+	OwnTransactions bool
+}
+
+var registry []Job
+
+// Register adds a job to the ones Start runs.
+func Register(job Job) {
+	registry = append(registry, job)
+}
+
+// Start runs every registered job in the background, once right away and then every interval.
+func Start() {
+	for _, job := range registry {
+		go func(job Job) {
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+			for {
+				if err := RunOnce(job); err != nil {
+					fmt.Printf("Job %s failed: %v\n", job.Name, err)
+				}
+				<-ticker.C
+			}
+		}(job)
+	}
+}
+
+// lockKey maps a job name to the key of its Postgres advisory lock.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("pagcore-job:" + name))
+	return int64(h.Sum64())
+}
+
+// RunOnce runs the job unless another replica holds its lock or ran it less than an interval
+// ago, and records the run in job_runs.
+func RunOnce(job Job) error {
+	started := time.Now().UTC()
+	ran := false
+	var affected int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", lockKey(job.Name)).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+		// Replicas tick at different moments, so check when the job last ran anywhere
+		var last models.JobRun
+		if err := tx.Where("name = ?", job.Name).Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		if !last.LastRunAt.IsZero() && started.Sub(last.LastRunAt) < job.Interval*9/10 {
+			return nil
+		}
+		ran = true
+		var err error
+		if job.OwnTransactions {
+			affected, err = job.Run(config.DB)
+		} else {
+			affected, err = job.Run(tx)
+		}
+		return err
+	})
+	if !ran {
+		return err
+	}
+	run := models.JobRun{
+		Name:         job.Name,
+		LastRunAt:    started,
+		LastDuration: time.Since(started).Milliseconds(),
+		LastAffected: affected,
+	}
+	if err != nil {
+		run.LastError = err.Error()
+	} else {
+		run.LastSuccessAt = &started
+	}
+	columns := []string{"last_run_at", "last_duration", "last_affected", "last_error", "updated_at"}
+	if err == nil {
+		columns = append(columns, "last_success_at")
+	}
+	if dbErr := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&run).Error; dbErr != nil {
+		fmt.Printf("Failed to record run of job %s: %v\n", job.Name, dbErr)
+	}
+	if err == nil && affected > 0 {
+		fmt.Printf("Job %s changed %d rows\n", job.Name, affected)
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// DeleteExpiredSessions removes sessions the auth middleware no longer accepts.
+func DeleteExpiredSessions(tx *gorm.DB) (int64, error) {
+	result := tx.Where("expires_at < ?", time.Now().UTC()).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteExpiredStreamTickets removes event stream tickets nobody redeemed in time.
+func DeleteExpiredStreamTickets(tx *gorm.DB) (int64, error) {
+	result := tx.Where("expires_at < ?", time.Now().UTC()).Delete(&models.StreamTicket{})
+	return result.RowsAffected, result.Error
+}
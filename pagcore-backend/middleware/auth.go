@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm/clause"
 )
 
 type Claims struct {
@@ -20,6 +22,29 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// StreamAuthMiddleware authenticates event streams. EventSource and WebSocket clients can't
+// set headers, so they redeem a ticket from POST /events/ticket in the ticket query parameter
+// instead of putting the session token in the URL. Other clients use the Authorization header.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			auth(c)
+			return
+		}
+		var redeemed models.StreamTicket
+		result := config.DB.Clauses(clause.Returning{}).Where("ticket = ? AND expires_at > ?", ticket, time.Now().UTC()).Delete(&redeemed)
+		if result.Error != nil || result.RowsAffected == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Ticket inválido ou expirado"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", redeemed.UserID)
+		c.Next()
+	}
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -63,3 +88,37 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// MerchantMiddleware lets staff act on the merchant account in the :id route param. Handlers
+// behind it see the merchant as user_id, the staff member is kept in staff_id.
+func MerchantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		merchantID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Estabelecimento inválido"})
+			c.Abort()
+			return
+		}
+		var staff models.MerchantStaff
+		if err := config.DB.Where("merchant_id = ? AND user_id = ?", merchantID, c.GetUint("user_id")).First(&staff).Error; err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado"})
+			c.Abort()
+			return
+		}
+		c.Set("staff_id", staff.UserID)
+		c.Set("merchant_role", string(staff.Role))
+		c.Set("user_id", staff.MerchantID)
+		c.Next()
+	}
+}
+
+func MerchantOwnerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("merchant_role") != string(models.MerchantStaffRoleOwner) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Apenas responsáveis podem fazer isso"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+type FeeTransactionType string
+type FeeKind string
+
+const (
+	FeeTransactionTransfer   FeeTransactionType = "transfer"
+	FeeTransactionQRPayment  FeeTransactionType = "qr_payment"
+	FeeTransactionWithdrawal FeeTransactionType = "withdrawal"
+	FeeKindFlat              FeeKind            = "flat"
+	FeeKindPercentage        FeeKind            = "percentage"
+	FeeKindTiered            FeeKind            = "tiered"
+)
+
+// FeeSchedule defines how much the platform charges for a kind of movement. An empty
+// UserTier applies to every tier without a schedule of its own. MinFee and MaxFee cap any kind.
+type FeeSchedule struct {
+	ID              uint               `gorm:"primaryKey"`
+	TransactionType FeeTransactionType `gorm:"not null;index"`
+	UserTier        UserTier           `gorm:"index"`
+	Currency        string             `gorm:"size:3;not null;default:BRL"`
+	Kind            FeeKind            `gorm:"not null"`
+	FlatAmount      float64            `gorm:"default:0"`
+	Percentage      float64            `gorm:"default:0"` // 1.5 means 1.5%
+	MinFee          *float64
+	MaxFee          *float64
+	Tiers           []FeeTier `gorm:"foreignKey:ScheduleID;constraint:OnDelete:CASCADE"`
+	Active          bool      `gorm:"default:true"`
+	CreatedAt       time.Time `gorm:"default:now()"`
+	UpdatedAt       time.Time `gorm:"default:now()"`
+}
+
+// FeeTier is a bracket of a tiered schedule, covering amounts up to UpTo (nil means no upper bound).
+type FeeTier struct {
+	ID         uint `gorm:"primaryKey"`
+	ScheduleID uint `gorm:"index"`
+	UpTo       *float64
+	FlatAmount float64 `gorm:"default:0"`
+	Percentage float64 `gorm:"default:0"`
+}
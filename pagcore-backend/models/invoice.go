@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Invoice adds boleto-style terms to a payment request: line items, a due date, an early
+// payment discount and late charges. The request holds the principal and goes through the
+// usual accept path, the amount owed is worked out when it is paid.
+type Invoice struct {
+	ID               uint          `gorm:"primaryKey"`
+	PaymentRequestID uint          `gorm:"uniqueIndex"`
+	Items            []InvoiceItem `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
+	DueDate          time.Time     `gorm:"type:date;not null"`
+	EarlyDiscount    float64       `gorm:"default:0"` // Taken off when paid up to DiscountUntil
+	DiscountUntil    *time.Time    `gorm:"type:date"`
+	DailyInterest    float64       `gorm:"default:0"` // Percent of the principal per day late, 0.033 means 0.033%
+	LateFee          float64       `gorm:"default:0"` // Fixed, charged once after the due date
+	PaidAt           *time.Time
+	AmountCharged    *float64  // What the payer actually paid, discount and charges included
+	CreatedAt        time.Time `gorm:"default:now()"`
+}
+
+type InvoiceItem struct {
+	ID          uint    `gorm:"primaryKey"`
+	InvoiceID   uint    `gorm:"index"`
+	Description string  `gorm:"not null"`
+	Quantity    float64 `gorm:"not null"`
+	UnitPrice   float64 `gorm:"not null"`
+	Total       float64 `gorm:"not null"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// JobRun is the last run of a background job on any replica.
+type JobRun struct {
+	Name          string `gorm:"primaryKey"`
+	LastRunAt     time.Time
+	LastSuccessAt *time.Time
+	LastDuration  int64 // Milliseconds
+	LastAffected  int64
+	LastError     string
+	UpdatedAt     time.Time `gorm:"default:now()"`
+}
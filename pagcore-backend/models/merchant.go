@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type MerchantStaffRole string
+type SettlementSchedule string
+
+const (
+	MerchantStaffRoleOwner    MerchantStaffRole  = "owner"    // Manages the profile, staff and settlement
+	MerchantStaffRoleOperator MerchantStaffRole  = "operator" // Charges customers and sees payments
+	SettlementScheduleManual  SettlementSchedule = "manual"
+	SettlementScheduleDaily   SettlementSchedule = "daily"
+	SettlementScheduleWeekly  SettlementSchedule = "weekly"
+)
+
+// MerchantProfile holds the business data of a merchant account. The account itself is a User
+// with AccountTypeMerchant, so it owns wallets and receives payments like anyone else.
+type MerchantProfile struct {
+	ID                 uint               `gorm:"primaryKey"`
+	UserID             uint               `gorm:"uniqueIndex"`
+	User               User               `gorm:"foreignKey:UserID"`
+	CNPJ               string             `gorm:"unique;not null"`
+	LegalName          string             `gorm:"not null"`
+	TradeName          string             `gorm:"not null"` // Shown to payers instead of the legal name
+	MCC                string             `gorm:"size:4;not null"`
+	SettlementSchedule SettlementSchedule `gorm:"default:manual"`
+	SettlementUserID   *uint              // Owner whose default wallet receives settlements
+	LastSettledAt      *time.Time
+	CreatedAt          time.Time `gorm:"default:now()"`
+	UpdatedAt          time.Time `gorm:"default:now()"`
+}
+
+// MerchantStaff gives a personal account access to a merchant account.
+type MerchantStaff struct {
+	ID         uint              `gorm:"primaryKey"`
+	MerchantID uint              `gorm:"uniqueIndex:idx_merchant_staff"` // User ID of the merchant account
+	UserID     uint              `gorm:"uniqueIndex:idx_merchant_staff;index"`
+	User       User              `gorm:"foreignKey:UserID"`
+	Role       MerchantStaffRole `gorm:"not null"`
+	CreatedAt  time.Time         `gorm:"default:now()"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+type NotificationType string
+
+const (
+	NotificationTransferReceived        NotificationType = "transfer.received"
+	NotificationQRPaid                  NotificationType = "qr.paid"
+	NotificationPaymentLinkPaid         NotificationType = "payment_link.paid"
+	NotificationPaymentRequestCreated   NotificationType = "payment_request.created"
+	NotificationPaymentRequestPaid      NotificationType = "payment_request.paid"
+	NotificationPaymentRequestDeclined  NotificationType = "payment_request.declined"
+	NotificationPaymentRequestCancelled NotificationType = "payment_request.cancelled"
+	NotificationPaymentRequestReminder  NotificationType = "payment_request.reminder"
+	NotificationNewDevice               NotificationType = "login.new_device"
+)
+
+// Notification is an entry of the user's inbox.
+type Notification struct {
+	ID            uint             `gorm:"primaryKey"`
+	UserID        uint             `gorm:"index:idx_notifications_user"`
+	Type          NotificationType `gorm:"not null"`
+	Title         string           `gorm:"not null"`
+	Body          string
+	Data          string     // JSON with the IDs of related records
+	ReadAt        *time.Time `gorm:"index:idx_notifications_user"`
+	EmailPending  bool       `gorm:"default:false;index"` // The user wants this type by email too
+	EmailAttempts int        `gorm:"default:0"`
+	EmailedAt     *time.Time
+	CreatedAt     time.Time `gorm:"default:now()"`
+}
+
+// NotificationPreference overrides whether a notification type is also sent by email.
+type NotificationPreference struct {
+	ID     uint             `gorm:"primaryKey"`
+	UserID uint             `gorm:"uniqueIndex:idx_notification_preference"`
+	Type   NotificationType `gorm:"uniqueIndex:idx_notification_preference"`
+	Email  bool
+}
+
+// UserDevice is a browser or app a user has logged in from, to warn about new ones.
+type UserDevice struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"uniqueIndex:idx_user_device"`
+	Fingerprint string `gorm:"uniqueIndex:idx_user_device"` // SHA-256 of the User-Agent
+	UserAgent   string
+	LastIP      string
+	CreatedAt   time.Time `gorm:"default:now()"`
+	LastSeenAt  time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// OutboxEvent is a domain event written in the same DB transaction as the change it describes.
+// The relay publishes it to the registered sinks after commit.
+type OutboxEvent struct {
+	ID            uint   `gorm:"primaryKey"` // Also the relay order
+	AggregateType string `gorm:"not null;index:idx_outbox_aggregate"`
+	AggregateID   uint   `gorm:"not null;index:idx_outbox_aggregate"`
+	EventType     string `gorm:"not null"`
+	UserID        uint   `gorm:"index"`    // Account the event is addressed to
+	Payload       string `gorm:"not null"` // JSON
+	Attempts      int    `gorm:"default:0"`
+	LastError     string
+	CreatedAt     time.Time  `gorm:"default:now()"`
+	PublishedAt   *time.Time `gorm:"index"`
+	PublishSeq    *int64     `gorm:"uniqueIndex"` // Set by the relay with published_at, the order streams follow
+	DeadAt        *time.Time // Set when the relay gave up on it, see outbox.MaxAttempts
+}
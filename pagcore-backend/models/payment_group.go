@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type PaymentGroupStatus string
+type PaymentSplitMode string
+
+const (
+	PaymentGroupStatusOpen    PaymentGroupStatus = "open"
+	PaymentGroupStatusSettled PaymentGroupStatus = "settled"
+	PaymentGroupStatusClosed  PaymentGroupStatus = "closed" // Some participant declined, cancelled or expired
+	PaymentSplitModeEven      PaymentSplitMode   = "even"
+	PaymentSplitModeCustom    PaymentSplitMode   = "custom"
+)
+
+type PaymentGroup struct {
+	ID           uint    `gorm:"primaryKey"`
+	RequesterID  uint    `gorm:"index"`
+	Requester    User    `gorm:"foreignKey:RequesterID"`
+	TotalAmount  float64 `gorm:"not null"`
+	Currency     string  `gorm:"size:3;not null;default:BRL"`
+	Description  string
+	SplitMode    PaymentSplitMode   `gorm:"not null"`
+	Status       PaymentGroupStatus `gorm:"default:open"`
+	Participants []PaymentRequest   `gorm:"foreignKey:GroupID"`
+	SettledAt    *time.Time
+	CreatedAt    time.Time `gorm:"default:now()"`
+	UpdatedAt    time.Time `gorm:"default:now()"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type PaymentLinkStatus string
+
+const (
+	PaymentLinkStatusActive    PaymentLinkStatus = "active"
+	PaymentLinkStatusExpired   PaymentLinkStatus = "expired" // Past ExpiresAt or used up
+	PaymentLinkStatusCancelled PaymentLinkStatus = "cancelled"
+)
+
+// PaymentLink is a shareable checkout URL, the web counterpart of a QR code.
+type PaymentLink struct {
+	ID          uint     `gorm:"primaryKey"`
+	UserID      uint     `gorm:"index"`
+	User        User     `gorm:"foreignKey:UserID"`
+	Token       string   `gorm:"uniqueIndex"` // Public identifier used in the URL
+	WalletID    *uint    // Receiving wallet, defaults to the user's default wallet
+	Amount      *float64 // Nil for open amount links
+	Currency    string   `gorm:"size:3;not null;default:BRL"` // Currency of the receiving wallet
+	Description string
+	RedirectURL string            // Where the checkout sends the payer after paying
+	Status      PaymentLinkStatus `gorm:"default:active"`
+	MaxUses     *int              // Nil means unlimited
+	UseCount    int               `gorm:"default:0"`
+	CreatedAt   time.Time         `gorm:"default:now()"`
+	ExpiresAt   *time.Time        // Nil means the link never expires
+	CancelledAt *time.Time
+}
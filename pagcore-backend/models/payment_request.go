@@ -5,20 +5,32 @@ import "time"
 type PaymentStatus string
 
 const (
-	PaymentStatusPending  PaymentStatus = "pending"
-	PaymentStatusAccepted PaymentStatus = "accepted"
-	PaymentStatusDeclined PaymentStatus = "declined"
+	PaymentStatusPending       PaymentStatus = "pending"
+	PaymentStatusAccepted      PaymentStatus = "accepted"
+	PaymentStatusDeclined      PaymentStatus = "declined"
+	PaymentStatusExpired       PaymentStatus = "expired"
+	PaymentStatusCancelled     PaymentStatus = "cancelled"
+	PaymentStatusPartiallyPaid PaymentStatus = "partially_paid"
 )
 
 type PaymentRequest struct {
-	ID          uint    `gorm:"primaryKey"`
-	RequesterID uint    `gorm:"index"`
-	Requester   User    `gorm:"foreignKey:RequesterID"`
-	PayerID     uint    `gorm:"index"`
-	Payer       User    `gorm:"foreignKey:PayerID"`
-	Amount      float64 `gorm:"not null"`
-	Description string
-	Status      PaymentStatus `gorm:"default:pending"`
-	CreatedAt   time.Time     `gorm:"default:now()"`
-	UpdatedAt   time.Time     `gorm:"default:now()"`
+	ID            uint    `gorm:"primaryKey"`
+	RequesterID   uint    `gorm:"index"`
+	Requester     User    `gorm:"foreignKey:RequesterID"`
+	PayerID       uint    `gorm:"index"`
+	Payer         User    `gorm:"foreignKey:PayerID"`
+	Amount        float64 `gorm:"not null"`
+	AmountPaid    float64 `gorm:"default:0"`
+	Currency      string  `gorm:"size:3;not null;default:BRL"` // Currency of the requester's receiving wallet
+	WalletID      *uint   // Requester's receiving wallet
+	Description   string
+	Status        PaymentStatus `gorm:"default:pending"`
+	Payments      []Transaction `gorm:"foreignKey:PaymentRequestID"`
+	GroupID       *uint         `gorm:"index"`
+	Invoice       *Invoice      `gorm:"foreignKey:PaymentRequestID"`
+	ExpiresAt     *time.Time    `gorm:"index"`
+	RemindedAt    *time.Time
+	ReminderCount int       `gorm:"default:0"`
+	CreatedAt     time.Time `gorm:"default:now()"`
+	UpdatedAt     time.Time `gorm:"default:now()"`
 }
@@ -3,19 +3,31 @@ package models
 import "time"
 
 type QRStatus string
+type QRType string
 
 const (
-	QRStatusActive  QRStatus = "active"
-	QRStatusExpired QRStatus = "expired"
+	QRStatusActive    QRStatus = "active"
+	QRStatusExpired   QRStatus = "expired"
+	QRStatusCancelled QRStatus = "cancelled"
+	QRTypeSingleUse   QRType   = "single_use"  // Fixed amount, paid once
+	QRTypeMultiUse    QRType   = "multi_use"   // Fixed amount, paid up to MaxUses times
+	QRTypeOpenAmount  QRType   = "open_amount" // Payer enters the amount, e.g. a static QR on the counter
 )
 
 type QRCode struct {
-	ID        uint `gorm:"primaryKey"`
-	UserID    uint `gorm:"index"`
-	User      User `gorm:"foreignKey:UserID"`
-	Amount    float64
-	Status    QRStatus  `gorm:"default:active"`
-	QRCode    string    `gorm:"not null"` // Base64 string
-	CreatedAt time.Time `gorm:"default:now()"`
-	ExpiresAt time.Time
+	ID          uint       `gorm:"primaryKey"`
+	UserID      uint       `gorm:"index"`
+	Token       string     `gorm:"uniqueIndex"` // Unguessable public identifier, also the BR Code txid
+	User        User       `gorm:"foreignKey:UserID"`
+	WalletID    *uint      // Receiving wallet, defaults to the user's default wallet
+	Type        QRType     `gorm:"default:single_use"`
+	Amount      float64    // Zero for open amount codes
+	Currency    string     `gorm:"size:3;not null;default:BRL"` // Currency of the receiving wallet
+	Status      QRStatus   `gorm:"default:active"`
+	MaxUses     *int       // Nil means unlimited
+	UseCount    int        `gorm:"default:0"`
+	Payload     string     // EMV BR Code, rendered on demand by GET /qr/:token/image. Empty on codes created before it existed until "migrate" fills it
+	CreatedAt   time.Time  `gorm:"default:now()"`
+	ExpiresAt   *time.Time // Nil means the code never expires
+	CancelledAt *time.Time
 }
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Statement is the closed snapshot of a wallet's month. Once written it is what the statement
+// of that month shows, whatever happens to the history afterwards.
+type Statement struct {
+	ID             uint            `gorm:"primaryKey"`
+	WalletID       uint            `gorm:"uniqueIndex:idx_statement_wallet_period"`
+	UserID         uint            `gorm:"index"`
+	Currency       string          `gorm:"size:3;not null"`
+	PeriodStart    time.Time       `gorm:"not null;uniqueIndex:idx_statement_wallet_period"`
+	PeriodEnd      time.Time       `gorm:"not null"` // Exclusive
+	OpeningBalance float64         `gorm:"not null"`
+	ClosingBalance float64         `gorm:"not null"`
+	TotalCredits   float64         `gorm:"not null"`
+	TotalDebits    float64         `gorm:"not null"`
+	Lines          []StatementLine `gorm:"foreignKey:StatementID;constraint:OnDelete:CASCADE"`
+	ClosedAt       time.Time       `gorm:"default:now()"`
+}
+
+// StatementLine is one movement of a closed statement with the balance right after it.
+type StatementLine struct {
+	ID            uint `gorm:"primaryKey"`
+	StatementID   uint `gorm:"index"`
+	TransactionID uint
+	PostedAt      time.Time
+	Type          TransactionType
+	Description   string
+	Counterparty  string
+	Amount        float64 // Positive for credits, negative for debits
+	Balance       float64
+}
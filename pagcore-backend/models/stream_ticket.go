@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// StreamTicket lets an EventSource or WebSocket client, which can't send headers, open one
+// event stream. It is short-lived and deleted when used, so it is harmless in access logs.
+type StreamTicket struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	Ticket    string    `gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"default:now()"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
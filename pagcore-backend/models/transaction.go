@@ -9,22 +9,38 @@ const (
 	TransactionTypeTransfer    TransactionType   = "transfer"
 	TransactionTypeDeposit     TransactionType   = "deposit"
 	TransactionTypeRefund      TransactionType   = "refund"
+	TransactionTypeInternal    TransactionType   = "internal" // Move between wallets of the same user
+	TransactionTypeFee         TransactionType   = "fee"
+	TransactionTypeSettlement  TransactionType   = "settlement" // Merchant balance paid out to its settlement account
 	TransactionStatusCompleted TransactionStatus = "completed"
 	TransactionStatusPending   TransactionStatus = "pending"
 	TransactionStatusFailed    TransactionStatus = "failed"
 )
 
 type Transaction struct {
-	ID          uint    `gorm:"primaryKey"`
-	SenderID    uint    `gorm:"index"`
-	Sender      User    `gorm:"foreignKey:SenderID"`
-	RecipientID uint    `gorm:"index"`
-	Recipient   User    `gorm:"foreignKey:RecipientID"`
-	Amount      float64 `gorm:"not null"`
-	Description string
-	Type        TransactionType   `gorm:"not null"`
-	Status      TransactionStatus `gorm:"default:completed"`
-	QRCodeID    *uint             `gorm:"index"`
-	QRCode      *QRCode           `gorm:"foreignKey:QRCodeID"`
-	CreatedAt   time.Time         `gorm:"default:now()"`
+	ID                uint    `gorm:"primaryKey"`
+	SenderID          uint    `gorm:"index"`
+	Sender            User    `gorm:"foreignKey:SenderID"`
+	RecipientID       uint    `gorm:"index"`
+	Recipient         User    `gorm:"foreignKey:RecipientID"`
+	SenderWalletID    *uint   `gorm:"index"`
+	RecipientWalletID *uint   `gorm:"index"`
+	Amount            float64 `gorm:"not null"` // Debited from the sender, in Currency
+	Currency          string  `gorm:"size:3;not null;default:BRL"`
+	// Set when the recipient wallet holds another currency
+	ConvertedAmount   *float64
+	ConvertedCurrency string   `gorm:"size:3"`
+	FXRate            *float64 // Effective rate applied, spread included
+	Fee               float64  `gorm:"default:0"`   // Charged on top of Amount, posted as a separate fee transaction
+	FeeForID          *uint    `gorm:"index"`       // On fee transactions, the movement that was charged
+	QuoteID           *string  `gorm:"uniqueIndex"` // Transfer quote honored by this movement, usable once
+	Description       string
+	Type              TransactionType   `gorm:"not null"`
+	Status            TransactionStatus `gorm:"default:completed"`
+	QRCodeID          *uint             `gorm:"index"`
+	QRCode            *QRCode           `gorm:"foreignKey:QRCodeID"`
+	PaymentRequestID  *uint             `gorm:"index"`
+	PaymentLinkID     *uint             `gorm:"index"`
+	AuthCode          *string           `gorm:"uniqueIndex"` // Receipt authentication code, set when the first receipt is issued
+	CreatedAt         time.Time         `gorm:"default:now()"`
 }
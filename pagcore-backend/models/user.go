@@ -4,24 +4,36 @@ import "time"
 
 type UserStatus string
 type UserRole string
+type UserTier string
+type UserAccountType string
 
 const (
-	UserStatusActive  UserStatus = "active"
-	UserStatusBlocked UserStatus = "blocked"
-	UserRoleUser      UserRole   = "user"
-	UserRoleAdmin     UserRole   = "admin"
+	UserStatusActive    UserStatus      = "active"
+	UserStatusBlocked   UserStatus      = "blocked"
+	UserRoleUser        UserRole        = "user"
+	UserRoleAdmin       UserRole        = "admin"
+	UserRoleSystem      UserRole        = "system" // Internal accounts, such as the platform revenue account
+	UserTierStandard    UserTier        = "standard"
+	UserTierPremium     UserTier        = "premium"
+	AccountTypePersonal UserAccountType = "personal" // A person identified by CPF
+	AccountTypeMerchant UserAccountType = "merchant" // A business identified by CNPJ, see MerchantProfile
 )
 
+// Owner of the wallets that collect fees
+const PlatformUsername = "pagcore.receita"
+
 type User struct {
-	ID        uint       `gorm:"primaryKey"`
-	FullName  string     `gorm:"not null"`
-	Email     string     `gorm:"unique;not null"`
-	Username  string     `gorm:"unique;not null"`
-	CPF       string     `gorm:"unique;not null"`
-	Password  string     `gorm:"not null"`
-	Balance   float64    `gorm:"default:0.00"`
-	Status    UserStatus `gorm:"default:active"`
-	Role      UserRole   `gorm:"default:user"`
-	CreatedAt time.Time  `gorm:"default:now()"`
-	UpdatedAt time.Time  `gorm:"default:now()"`
+	ID          uint            `gorm:"primaryKey"`
+	FullName    string          `gorm:"not null"`
+	Email       string          `gorm:"unique;not null"`
+	Username    string          `gorm:"unique;not null"`
+	CPF         *string         `gorm:"unique"` // Nil for merchant and system accounts
+	Password    string          `gorm:"not null"`
+	Balance     float64         `gorm:"default:0.00"`
+	Status      UserStatus      `gorm:"default:active"`
+	Role        UserRole        `gorm:"default:user"`
+	Tier        UserTier        `gorm:"default:standard"`
+	AccountType UserAccountType `gorm:"default:personal"`
+	CreatedAt   time.Time       `gorm:"default:now()"`
+	UpdatedAt   time.Time       `gorm:"default:now()"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	DefaultWalletName = "Principal"
+	BaseCurrency      = "BRL" // Currency of User.Balance and of wallets created without one
+)
+
+// Wallet is a pocket of money owned by a user. User.Balance holds the sum of the user's BRL wallets.
+type Wallet struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"uniqueIndex:idx_wallet_user_name"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_wallet_user_name"`
+	Balance   float64   `gorm:"default:0.00"`
+	Currency  string    `gorm:"size:3;not null;default:BRL"`
+	IsDefault bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"default:now()"`
+	UpdatedAt time.Time `gorm:"default:now()"`
+}
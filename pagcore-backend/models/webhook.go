@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryDead      WebhookDeliveryStatus = "dead" // Gave up after the last retry, can be redelivered by hand
+)
+
+type WebhookEndpoint struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	URL       string    `gorm:"not null"`
+	Secret    string    `gorm:"not null"` // HMAC key for the PagCore-Signature header
+	Events    string    `gorm:"not null"` // Comma separated event types
+	Active    bool      `gorm:"default:true"`
+	CreatedAt time.Time `gorm:"default:now()"`
+}
+
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey"`
+	EndpointID     uint                  `gorm:"index"`
+	Endpoint       WebhookEndpoint       `gorm:"foreignKey:EndpointID"`
+	EventID        string                `gorm:"index;not null"`
+	EventType      string                `gorm:"not null"`
+	Payload        string                `gorm:"not null"` // Exact JSON body that gets signed and sent
+	Status         WebhookDeliveryStatus `gorm:"default:pending;index"`
+	Attempts       int                   `gorm:"default:0"`
+	NextAttemptAt  time.Time             `gorm:"index"`
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time `gorm:"default:now()"`
+}
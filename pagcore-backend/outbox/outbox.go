@@ -0,0 +1,138 @@
+// Package outbox records domain events inside the DB transaction that caused them and relays
+// them to pluggable sinks afterwards, so no event is lost if the process dies after a commit.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventTransferReceived        = "transfer.received"
+	EventQRPaid                  = "qr.paid"
+	EventPaymentRequestCreated   = "payment_request.created"
+	EventPaymentRequestAccepted  = "payment_request.accepted"
+	EventPaymentRequestDeclined  = "payment_request.declined"
+	EventPaymentRequestCancelled = "payment_request.cancelled"
+	EventBalanceChanged          = "balance.changed"
+	EventNotificationCreated     = "notification.created"
+
+	// Aggregates the events are about. Events of one aggregate are relayed in order.
+	AggregateUser           = "user"
+	AggregateQRCode         = "qr_code"
+	AggregatePaymentRequest = "payment_request"
+	AggregateWallet         = "wallet"
+
+	batchSize = 100
+	// After this many failed attempts an event is marked dead and stops holding back its aggregate
+	MaxAttempts = 10
+)
+
+// Event is what domain code publishes.
+type Event struct {
+	Type        string
+	UserID      uint // Account the event is addressed to
+	Aggregate   string
+	AggregateID uint
+	Data        interface{}
+}
+
+// Sink receives relayed events. Publish runs inside the relay transaction, sinks that write to
+// the DB get exactly-once delivery, others at-least-once.
+type Sink interface {
+	Name() string
+	Publish(tx *gorm.DB, e *models.OutboxEvent) error
+}
+
+var sinks []Sink
+
+// Register adds a sink every relayed event is published to.
+func Register(sink Sink) {
+	sinks = append(sinks, sink)
+}
+
+// Publish writes the event to the outbox. Call it with the transaction of the change.
+func Publish(tx *gorm.DB, e Event) error {
+	payload, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		AggregateType: e.Aggregate,
+		AggregateID:   e.AggregateID,
+		EventType:     e.Type,
+		UserID:        e.UserID,
+		Payload:       string(payload),
+	}).Error
+}
+
+// Relay publishes pending events in ID order to every sink. When an event fails, later events
+// of the same aggregate wait until it succeeds or dies so they never overtake it. It runs as a job.
+func Relay(tx *gorm.DB) (int64, error) {
+	var events []models.OutboxEvent
+	// Events behind one that already failed are left out here, so a stuck aggregate can't fill
+	// every batch and starve the others
+	err := tx.Where("published_at IS NULL AND dead_at IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM outbox_events f WHERE f.aggregate_type = outbox_events.aggregate_type AND f.aggregate_id = outbox_events.aggregate_id " +
+			"AND f.id < outbox_events.id AND f.published_at IS NULL AND f.dead_at IS NULL AND f.attempts > 0)").
+		Order("id").Limit(batchSize).Find(&events).Error
+	if err != nil {
+		return 0, err
+	}
+	blocked := make(map[string]bool)
+	var published int64
+	for i := range events {
+		e := &events[i]
+		key := fmt.Sprintf("%s:%d", e.AggregateType, e.AggregateID)
+		if blocked[key] {
+			continue
+		}
+		if err := relayOne(tx, e); err != nil {
+			blocked[key] = true
+			if err := recordFailure(tx, e, err); err != nil {
+				return published, err
+			}
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+// recordFailure counts a failed attempt, giving up on the event after MaxAttempts.
+func recordFailure(tx *gorm.DB, e *models.OutboxEvent, cause error) error {
+	fmt.Printf("Failed to relay outbox event %d: %v\n", e.ID, cause)
+	updates := map[string]interface{}{"attempts": e.Attempts + 1, "last_error": cause.Error()}
+	if e.Attempts+1 >= MaxAttempts {
+		fmt.Printf("Giving up on outbox event %d after %d attempts\n", e.ID, e.Attempts+1)
+		updates["dead_at"] = time.Now().UTC()
+	}
+	return tx.Model(e).Updates(updates).Error
+}
+
+// relayOne publishes one event under a savepoint, so a failing sink undoes what the others wrote.
+func relayOne(tx *gorm.DB, e *models.OutboxEvent) error {
+	savepoint := fmt.Sprintf("outbox_%d", e.ID)
+	if err := tx.SavePoint(savepoint).Error; err != nil {
+		return err
+	}
+	for _, sink := range sinks {
+		if err := sink.Publish(tx, e); err != nil {
+			tx.RollbackTo(savepoint)
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	// Relays run one at a time under the job lock, so publish_seq also follows commit order,
+	// unlike the ID which is taken when the event is written
+	updates := map[string]interface{}{"published_at": time.Now().UTC(), "publish_seq": gorm.Expr("nextval('outbox_publish_seq')")}
+	if err := tx.Model(e).Updates(updates).Error; err != nil {
+		tx.RollbackTo(savepoint)
+		return err
+	}
+	return nil
+}
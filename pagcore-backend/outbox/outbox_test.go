@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// failingSink fails the events in fail, to see what the relay does with the rest.
+type failingSink struct{ fail map[uint]bool }
+
+func (failingSink) Name() string { return "failing" }
+
+func (s failingSink) Publish(tx *gorm.DB, e *models.OutboxEvent) error {
+	if s.fail[e.ID] {
+		return errors.New("sink down")
+	}
+	return nil
+}
+
+type pendingEvent struct {
+	id        uint
+	aggregate string
+	attempts  int
+}
+
+func TestRelayOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		pending   []pendingEvent
+		fail      map[uint]bool
+		want      []uint // Order the bus sees
+		wantDead  uint   // Event that should be marked dead, if any
+		published int64
+	}{
+		{
+			name:      "all in ID order",
+			pending:   []pendingEvent{{1, "wallet", 0}, {2, "user", 0}, {3, "wallet", 0}},
+			want:      []uint{1, 2, 3},
+			published: 3,
+		},
+		{
+			name:      "a failure holds back its aggregate only",
+			pending:   []pendingEvent{{1, "wallet", 0}, {2, "user", 0}, {3, "wallet", 0}, {4, "wallet", 0}, {5, "user", 0}},
+			fail:      map[uint]bool{3: true},
+			want:      []uint{1, 2, 5},
+			published: 3,
+		},
+		{
+			name:      "the first event of an aggregate failing blocks all of it",
+			pending:   []pendingEvent{{1, "wallet", 2}, {2, "wallet", 0}, {3, "user", 0}},
+			fail:      map[uint]bool{1: true},
+			want:      []uint{3},
+			published: 1,
+		},
+		{
+			name:      "last attempt marks the event dead",
+			pending:   []pendingEvent{{7, "wallet", MaxAttempts - 1}, {8, "user", 0}},
+			fail:      map[uint]bool{7: true},
+			want:      []uint{8},
+			wantDead:  7,
+			published: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard, SkipDefaultTransaction: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bus := NewMemoryBus()
+			received := bus.Subscribe(len(tt.pending))
+			saved := sinks
+			sinks = []Sink{failingSink{fail: tt.fail}, bus}
+			defer func() { sinks = saved }()
+
+			rows := sqlmock.NewRows([]string{"id", "aggregate_type", "aggregate_id", "event_type", "user_id", "payload", "attempts"})
+			for _, e := range tt.pending {
+				rows.AddRow(e.id, e.aggregate, 1, "balance.changed", 1, "{}", e.attempts)
+			}
+			// Pending events, minus those behind an earlier failed one, in ID order
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "outbox_events" WHERE (published_at IS NULL AND dead_at IS NULL) AND (NOT EXISTS`) +
+				`.*f\.id < outbox_events\.id.*f\.attempts > 0.*ORDER BY id LIMIT`).
+				WillReturnRows(rows)
+			blocked := make(map[string]bool)
+			for _, e := range tt.pending {
+				if blocked[e.aggregate] {
+					continue
+				}
+				savepoint := "outbox_" + strconv.FormatUint(uint64(e.id), 10)
+				mock.ExpectExec("SAVEPOINT " + savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+				if tt.fail[e.id] {
+					blocked[e.aggregate] = true
+					mock.ExpectExec("ROLLBACK TO SAVEPOINT " + savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+					update := `UPDATE "outbox_events" SET "attempts"=\$1,"last_error"=\$2 WHERE`
+					if e.id == tt.wantDead {
+						update = `UPDATE "outbox_events" SET "attempts"=\$1,"dead_at"=\$2,"last_error"=\$3 WHERE`
+					}
+					mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+					continue
+				}
+				mock.ExpectExec(`UPDATE "outbox_events" SET "publish_seq"=nextval\('outbox_publish_seq'\),"published_at"=\$1 WHERE`).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			published, err := Relay(db)
+			if err != nil {
+				t.Fatalf("Relay: %v", err)
+			}
+			if published != tt.published {
+				t.Errorf("published = %d, want %d", published, tt.published)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			var got []uint
+			for len(received) > 0 {
+				got = append(got, (<-received).ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("bus got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("bus got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// LogSink prints every event, handy in development.
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Publish(tx *gorm.DB, e *models.OutboxEvent) error {
+	fmt.Printf("Event %d %s %s:%d user=%d %s\n", e.ID, e.EventType, e.AggregateType, e.AggregateID, e.UserID, e.Payload)
+	return nil
+}
+
+// MemoryBus fans events out to in-process subscribers, e.g. in tests. Slow subscribers miss
+// events once their buffer is full rather than stalling the relay.
+type MemoryBus struct {
+	mu   sync.Mutex
+	subs []chan models.OutboxEvent
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Name() string { return "memory" }
+
+// Subscribe returns a channel receiving every event published after the call.
+func (b *MemoryBus) Subscribe(buffer int) <-chan models.OutboxEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan models.OutboxEvent, buffer)
+	b.subs = append(b.subs, ch)
+	return ch
+}
+
+func (b *MemoryBus) Publish(tx *gorm.DB, e *models.OutboxEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- *e:
+		default:
+		}
+	}
+	return nil
+}
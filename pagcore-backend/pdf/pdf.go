@@ -0,0 +1,210 @@
+// Package pdf writes simple text documents as PDF, page by page, so long documents can be
+// streamed. It only knows the standard Helvetica and Courier fonts, which need no embedding.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 in points, with the same margin on every side
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 40.0
+)
+
+// Fonts, the standard 14 ones every reader has
+const (
+	Helvetica     = "F1"
+	HelveticaBold = "F2"
+	Courier       = "F3"
+)
+
+// winAnsi maps the characters WinAnsiEncoding places in 0x80-0x9f
+var winAnsi = map[rune]byte{'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97}
+
+var fontNames = map[string]string{Helvetica: "Helvetica", HelveticaBold: "Helvetica-Bold", Courier: "Courier"}
+
+// Reserved objects, pages are numbered after them
+const (
+	catalogObj = 1
+	pagesObj   = 2
+	firstFont  = 3
+)
+
+// Document streams a PDF to w. Call Close to finish it.
+type Document struct {
+	w       *countingWriter
+	offsets map[int]int64
+	nextObj int
+	pages   []int
+	page    *bytes.Buffer
+	y       float64
+	title   string
+	err     error
+}
+
+// New starts a document. The title goes in the document info.
+func New(w io.Writer, title string) *Document {
+	d := &Document{w: &countingWriter{w: w}, offsets: make(map[int]int64), title: title}
+	d.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	d.nextObj = firstFont
+	for _, id := range []string{Helvetica, HelveticaBold, Courier} {
+		d.object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", fontNames[id]))
+	}
+	return d
+}
+
+// Text writes a line in the given font and size at the left margin, moving to a new page when
+// the current one is full.
+func (d *Document) Text(font string, size float64, text string) {
+	d.TextAt(font, size, 0, text)
+}
+
+// TextAt is Text indented by x points.
+func (d *Document) TextAt(font string, size, x float64, text string) {
+	leading := size * 1.4
+	if d.page == nil || d.y-leading < margin {
+		d.newPage()
+	}
+	d.y -= leading
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, margin+x, d.y, escape(text))
+}
+
+// Space leaves an empty gap of the given height.
+func (d *Document) Space(height float64) {
+	if d.page != nil {
+		d.y -= height
+	}
+}
+
+// Rule draws a horizontal line across the page.
+func (d *Document) Rule() {
+	if d.page == nil || d.y-6 < margin {
+		d.newPage()
+	}
+	d.y -= 6
+	fmt.Fprintf(d.page, "%.2f %.2f m %.2f %.2f l 0.5 w S\n", margin, d.y, pageWidth-margin, d.y)
+}
+
+// Close writes the last page and the document trailer. It returns the first write error.
+func (d *Document) Close() error {
+	if d.page == nil {
+		d.newPage()
+	}
+	d.flushPage()
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	d.objectAt(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	d.objectAt(catalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObj))
+	info := d.object(fmt.Sprintf("<< /Title (%s) /Producer (PagCore) >>", escape(d.title)))
+	xref := d.w.n
+	d.printf("xref\n0 %d\n0000000000 65535 f \n", d.nextObj)
+	for id := 1; id < d.nextObj; id++ {
+		d.printf("%010d 00000 n \n", d.offsets[id])
+	}
+	d.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", d.nextObj, catalogObj, info, xref)
+	return d.err
+}
+
+func (d *Document) newPage() {
+	d.flushPage()
+	d.page = new(bytes.Buffer)
+	d.y = pageHeight - margin
+}
+
+// flushPage writes the current page out, so only one page is ever held in memory.
+func (d *Document) flushPage() {
+	if d.page == nil {
+		return
+	}
+	content := d.object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", d.page.Len(), d.page.Bytes()))
+	resources := make([]string, 0, len(fontNames))
+	for i, id := range []string{Helvetica, HelveticaBold, Courier} {
+		resources = append(resources, fmt.Sprintf("/%s %d 0 R", id, firstFont+i))
+	}
+	page := d.object(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+		pagesObj, pageWidth, pageHeight, strings.Join(resources, " "), content))
+	d.pages = append(d.pages, page)
+	d.page = nil
+}
+
+func (d *Document) object(body string) int {
+	id := d.nextObj
+	d.nextObj++
+	d.objectAt(id, body)
+	return id
+}
+
+func (d *Document) objectAt(id int, body string) {
+	d.offsets[id] = d.w.n
+	d.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (d *Document) printf(format string, args ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// escape turns text into the body of a PDF literal string in WinAnsiEncoding. Characters
+// outside it become '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteByte(byte(r))
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			b.WriteByte(winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// Column fits text in width characters, cutting it or padding it on the right. With a
+// monospaced font like Courier this lines up tables.
+func Column(text string, width int) string {
+	if n := utf8.RuneCountInString(text); n <= width {
+		return text + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(text)
+	if width <= 1 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// RightColumn is Column aligned to the right, for amounts.
+func RightColumn(text string, width int) string {
+	if n := utf8.RuneCountInString(text); n < width {
+		return strings.Repeat(" ", width-n) + text
+	}
+	return Column(text, width)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
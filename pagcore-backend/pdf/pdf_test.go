@@ -0,0 +1,144 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Extrato de março", "Extrato de mar\xe7o"},
+		{"delimiters", `a (b) \c`, `a \(b\) \\c`},
+		{"line breaks become spaces", "a\nb\r\tc", "a b  c"},
+		{"win ansi extras", "€ – “x”", "\x80 \x96 \x93x\x94"},
+		{"outside the encoding", "日本", "??"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escape(tt.in); got != tt.want {
+				t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumn(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  string
+		right string
+	}{
+		{"abc", 5, "abc  ", "  abc"},
+		{"abcde", 5, "abcde", "abcde"},
+		{"abcdef", 5, "abcd…", "abcd…"},
+		{"ção", 4, "ção ", " ção"},
+		{"abc", 1, "a", "a"},
+		{"", 2, "  ", "  "},
+	}
+	for _, tt := range tests {
+		if got := Column(tt.text, tt.width); got != tt.want {
+			t.Errorf("Column(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+		if got := RightColumn(tt.text, tt.width); got != tt.right {
+			t.Errorf("RightColumn(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.right)
+		}
+	}
+}
+
+// checkStructure verifies what readers rely on: every xref offset lands on its object, stream
+// lengths are right and the trailer points at the xref table.
+func checkStructure(t *testing.T, doc []byte) (pages int) {
+	t.Helper()
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(doc)
+	if startxref == nil {
+		t.Fatal("no startxref at the end")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(doc[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	lines := strings.Split(string(doc[xref:]), "\n")
+	var count int
+	fmt.Sscanf(lines[1], "0 %d", &count)
+	for id := 1; id < count; id++ {
+		offset, err := strconv.Atoi(lines[2+id][:10])
+		if err != nil {
+			t.Fatalf("xref entry %d: %v", id, err)
+		}
+		if want := fmt.Sprintf("%d 0 obj\n", id); !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Fatalf("object %d is not at offset %d", id, offset)
+		}
+	}
+	for _, m := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)\nendstream`).FindAllSubmatch(doc, -1) {
+		if n, _ := strconv.Atoi(string(m[1])); n != len(m[2]) {
+			t.Errorf("stream /Length %d, actual %d", n, len(m[2]))
+		}
+	}
+	n, _ := strconv.Atoi(string(regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(doc)[1]))
+	return n
+}
+
+func TestDocument(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     int
+		wantPages int
+	}{
+		{"empty document still has a page", 0, 1},
+		{"one page", 10, 1},
+		{"breaks into pages", 200, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			doc := New(&buf, "Extrato (teste)")
+			for i := 0; i < tt.lines; i++ {
+				doc.Text(Courier, 8, fmt.Sprintf("linha %d", i))
+				if i%50 == 0 {
+					doc.Rule()
+				}
+			}
+			if err := doc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.Bytes()
+			if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) {
+				t.Fatal("missing PDF header")
+			}
+			if pages := checkStructure(t, out); pages != tt.wantPages {
+				t.Errorf("pages = %d, want %d", pages, tt.wantPages)
+			}
+			if !bytes.Contains(out, []byte(`/Title (Extrato \(teste\))`)) {
+				t.Error("title not escaped in the document info")
+			}
+		})
+	}
+}
+
+type failingWriter struct{ left int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n := w.left
+		w.left = 0
+		return n, errors.New("disk full")
+	}
+	w.left -= len(p)
+	return len(p), nil
+}
+
+func TestCloseReturnsWriteError(t *testing.T) {
+	doc := New(&failingWriter{left: 100}, "x")
+	doc.Text(Helvetica, 10, "texto")
+	if err := doc.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Close = %v, want disk full", err)
+	}
+}
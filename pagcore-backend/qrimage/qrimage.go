@@ -0,0 +1,165 @@
+// Package qrimage renders QR code payloads as PNG or SVG images.
+package qrimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+	MinSize   = 128
+	MaxSize   = 2048
+	// The logo covers at most this fraction of the code width, which level H can recover from
+	logoRatio = 0.22
+)
+
+var ErrInvalidOptions = errors.New("qrimage: invalid options")
+
+// Options controls how a payload is drawn.
+type Options struct {
+	Format     string // FormatPNG or FormatSVG
+	Size       int    // Width and height in pixels
+	Level      qrcode.RecoveryLevel
+	Foreground color.RGBA
+	Background color.RGBA
+	Logo       image.Image // Optional, drawn in the center
+}
+
+// DefaultOptions matches the images GenerateQR used to store.
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       256,
+		Level:      qrcode.Medium,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// ParseLevel maps L, M, Q and H to recovery levels.
+func ParseLevel(s string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qrcode.Low, nil
+	case "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+	return 0, ErrInvalidOptions
+}
+
+// ParseColor reads a hex color such as "1a2b3c" or "#1a2b3c".
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, ErrInvalidOptions
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidOptions
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Render draws the payload and returns the image bytes with their content type.
+func Render(content string, opts Options) ([]byte, string, error) {
+	if opts.Size < MinSize || opts.Size > MaxSize {
+		return nil, "", ErrInvalidOptions
+	}
+	if opts.Logo != nil && opts.Level < qrcode.High {
+		opts.Level = qrcode.Highest // Keep the code readable under the logo
+	}
+	q, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, "", err
+	}
+	q.ForegroundColor = opts.Foreground
+	q.BackgroundColor = opts.Background
+	switch opts.Format {
+	case FormatPNG:
+		data, err := renderPNG(q, opts)
+		return data, "image/png", err
+	case FormatSVG:
+		data, err := renderSVG(q, opts)
+		return data, "image/svg+xml", err
+	}
+	return nil, "", ErrInvalidOptions
+}
+
+func renderPNG(q *qrcode.QRCode, opts Options) ([]byte, error) {
+	if opts.Logo == nil {
+		return q.PNG(opts.Size)
+	}
+	base := q.Image(opts.Size)
+	img := image.NewRGBA(base.Bounds())
+	draw.Draw(img, img.Bounds(), base, image.Point{}, draw.Src)
+	logoSize := int(float64(img.Bounds().Dx()) * logoRatio)
+	offset := (img.Bounds().Dx() - logoSize) / 2
+	drawScaled(img, image.Rect(offset, offset, offset+logoSize, offset+logoSize), opts.Logo)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawScaled draws src into dst rect using nearest neighbour sampling, which is enough for a logo.
+func drawScaled(dst draw.Image, rect image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sy := sb.Min.Y + (y-rect.Min.Y)*sb.Dy()/rect.Dy()
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sx := sb.Min.X + (x-rect.Min.X)*sb.Dx()/rect.Dx()
+			draw.Draw(dst, image.Rect(x, y, x+1, y+1), &image.Uniform{C: src.At(sx, sy)}, image.Point{}, draw.Over)
+		}
+	}
+}
+
+func renderSVG(q *qrcode.QRCode, opts Options) ([]byte, error) {
+	bitmap := q.Bitmap()
+	modules := len(bitmap)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`, hex(opts.Background))
+	fmt.Fprintf(&b, `<path fill="%s" d="`, hex(opts.Foreground))
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/>`)
+	if opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, opts.Logo); err != nil {
+			return nil, err
+		}
+		size := float64(modules) * logoRatio
+		offset := (float64(modules) - size) / 2
+		fmt.Fprintf(&b, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" href="data:image/png;base64,%s"/>`,
+			offset, offset, size, size, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	b.WriteString(`</svg>`)
+	return b.Bytes(), nil
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -15,6 +15,11 @@ func SetupRouter() *gin.Engine {
 		// Public
 		api.POST("/register", controllers.Register)
 		api.POST("/login", controllers.Login)
+		api.GET("/qr/public-key", controllers.GetQRPublicKey)
+		api.GET("/links/:token", controllers.GetPublicPaymentLink) // Hosted checkout, no login needed
+		api.GET("/receipts/:code", controllers.VerifyReceipt)
+		api.GET("/events", middleware.StreamAuthMiddleware(), controllers.StreamEvents)
+		api.GET("/events/ws", middleware.StreamAuthMiddleware(), controllers.StreamEventsWebSocket)
 
 		// Protected
 		protected := api.Group("")
@@ -22,17 +27,110 @@ func SetupRouter() *gin.Engine {
 		{
 			protected.POST("/logout", controllers.Logout)
 			protected.GET("/profile", controllers.GetProfile)
+			protected.POST("/events/ticket", controllers.CreateStreamTicket)
 			protected.PUT("/profile", controllers.UpdateProfile)
 			protected.GET("/dashboard", controllers.GetDashboard)
 			protected.POST("/transfer", controllers.MakeTransfer)
+			protected.POST("/transfer/quote", controllers.QuoteTransfer)
+			protected.GET("/fees/quote", controllers.GetFeeQuote)
+			protected.GET("/wallets", controllers.GetWallets)
+			protected.POST("/wallets", controllers.CreateWallet)
+			protected.POST("/wallets/move", controllers.MoveBetweenWallets)
+			protected.PUT("/wallets/:id/default", controllers.SetDefaultWallet)
+			protected.DELETE("/wallets/:id", controllers.DeleteWallet)
 			protected.GET("/transactions", controllers.GetTransactionHistory)
+			protected.GET("/transactions/export", controllers.ExportTransactions)
+			protected.GET("/transactions/:transaction_id/receipt", controllers.GetReceipt)
 			protected.GET("/payment/payment-requests", controllers.GetPaymentRequests)
 			protected.POST("/payment/request", controllers.CreatePaymentRequest)
 			protected.POST("/payment/accept/:id", controllers.AcceptPaymentRequest)
 			protected.POST("/payment/decline/:id", controllers.DeclinePaymentRequest)
+			protected.POST("/payment/cancel/:id", controllers.CancelPaymentRequest)
+			protected.POST("/payment/remind/:id", controllers.RemindPaymentRequest)
+			protected.POST("/payment/split", controllers.CreateSplitPaymentRequest)
+			protected.GET("/payment/split/:id", controllers.GetSplitPaymentRequest)
+			protected.GET("/qr", controllers.GetQRCodes)
 			protected.POST("/qr/generate", controllers.GenerateQR)
 			protected.POST("/qr/process", controllers.ProcessQR) // "Read" via API
-			protected.GET("qr/:id", controllers.GetQR)
+			protected.GET("/qr/:token", controllers.GetQR)
+			protected.GET("/qr/:token/payments", controllers.GetQRPayments)
+			protected.GET("/qr/:token/image", controllers.GetQRImage)
+			protected.POST("/qr/:token/cancel", controllers.CancelQR)
+			protected.POST("/links/:token/pay", controllers.PayPaymentLink)
+			protected.GET("/invoices", controllers.GetInvoices)
+			protected.POST("/invoices", controllers.CreateInvoice)
+			protected.GET("/invoices/payable", controllers.GetPayableInvoices)
+			protected.GET("/invoices/:invoice_id", controllers.GetInvoice)
+			protected.GET("/payment-links", controllers.GetPaymentLinks)
+			protected.POST("/payment-links", controllers.CreatePaymentLink)
+			protected.GET("/payment-links/:token/payments", controllers.GetPaymentLinkPayments)
+			protected.POST("/payment-links/:token/cancel", controllers.CancelPaymentLink)
+
+			protected.GET("/analytics", controllers.GetAnalytics)
+			protected.GET("/statements", controllers.GetStatement)
+			protected.GET("/statements/closed", controllers.GetClosedStatements)
+			protected.GET("/statements/export", controllers.ExportStatement)
+
+			protected.GET("/notifications", controllers.GetNotifications)
+			protected.POST("/notifications/read-all", controllers.MarkAllNotificationsRead)
+			protected.POST("/notifications/:id/read", controllers.MarkNotificationRead)
+			protected.GET("/notifications/preferences", controllers.GetNotificationPreferences)
+			protected.PUT("/notifications/preferences", controllers.UpdateNotificationPreferences)
+
+			protected.GET("/webhooks", controllers.GetWebhookEndpoints)
+			protected.POST("/webhooks", controllers.CreateWebhookEndpoint)
+			protected.PUT("/webhooks/:webhook_id", controllers.UpdateWebhookEndpoint)
+			protected.DELETE("/webhooks/:webhook_id", controllers.DeleteWebhookEndpoint)
+			protected.POST("/webhooks/:webhook_id/ping", controllers.PingWebhookEndpoint)
+			protected.GET("/webhooks/deliveries", controllers.GetWebhookDeliveries)
+			protected.POST("/webhooks/deliveries/:delivery_id/redeliver", controllers.RedeliverWebhook)
+
+			// Merchant accounts, staff act on them through /merchants/:id
+			protected.POST("/merchants", controllers.CreateMerchant)
+			protected.GET("/merchants", controllers.GetMyMerchants)
+			merchant := protected.Group("/merchants/:id")
+			merchant.Use(middleware.MerchantMiddleware())
+			{
+				merchant.GET("", controllers.GetMerchant)
+				merchant.GET("/wallets", controllers.GetWallets)
+				merchant.GET("/transactions", controllers.GetTransactionHistory)
+				merchant.GET("/transactions/export", controllers.ExportTransactions)
+				merchant.GET("/transactions/:transaction_id/receipt", controllers.GetReceipt)
+				merchant.GET("/analytics", controllers.GetAnalytics)
+				merchant.GET("/statements", controllers.GetStatement)
+				merchant.GET("/statements/closed", controllers.GetClosedStatements)
+				merchant.GET("/statements/export", controllers.ExportStatement)
+				merchant.GET("/qr", controllers.GetQRCodes)
+				merchant.POST("/qr/generate", controllers.GenerateQR)
+				merchant.GET("/qr/:token/payments", controllers.GetQRPayments)
+				merchant.POST("/qr/:token/cancel", controllers.CancelQR)
+				merchant.GET("/invoices", controllers.GetInvoices)
+				merchant.POST("/invoices", controllers.CreateInvoice)
+				merchant.GET("/invoices/:invoice_id", controllers.GetInvoice)
+				merchant.GET("/payment-links", controllers.GetPaymentLinks)
+				merchant.POST("/payment-links", controllers.CreatePaymentLink)
+				merchant.GET("/payment-links/:token/payments", controllers.GetPaymentLinkPayments)
+				merchant.POST("/payment-links/:token/cancel", controllers.CancelPaymentLink)
+				merchant.GET("/notifications", controllers.GetNotifications)
+				merchant.POST("/notifications/read-all", controllers.MarkAllNotificationsRead)
+
+				owner := merchant.Group("")
+				owner.Use(middleware.MerchantOwnerMiddleware())
+				{
+					owner.PUT("", controllers.UpdateMerchant)
+					owner.GET("/staff", controllers.GetMerchantStaff)
+					owner.PUT("/staff", controllers.SetMerchantStaff)
+					owner.DELETE("/staff/:user_id", controllers.RemoveMerchantStaff)
+					owner.POST("/settle", controllers.SettleMerchant)
+					owner.GET("/webhooks", controllers.GetWebhookEndpoints)
+					owner.POST("/webhooks", controllers.CreateWebhookEndpoint)
+					owner.PUT("/webhooks/:webhook_id", controllers.UpdateWebhookEndpoint)
+					owner.DELETE("/webhooks/:webhook_id", controllers.DeleteWebhookEndpoint)
+					owner.POST("/webhooks/:webhook_id/ping", controllers.PingWebhookEndpoint)
+					owner.GET("/webhooks/deliveries", controllers.GetWebhookDeliveries)
+					owner.POST("/webhooks/deliveries/:delivery_id/redeliver", controllers.RedeliverWebhook)
+				}
+			}
 
 			// Admin only
 			admin := protected.Group("/admin")
@@ -41,6 +139,12 @@ func SetupRouter() *gin.Engine {
 				admin.GET("/users", controllers.GetUsers)
 				admin.POST("/users/block/:id", controllers.BlockUser)
 				admin.GET("/stats", controllers.GetStats)
+				admin.GET("/jobs", controllers.GetJobRuns)
+				admin.PUT("/users/:id/tier", controllers.SetUserTier)
+				admin.GET("/fees", controllers.GetFeeSchedules)
+				admin.POST("/fees", controllers.CreateFeeSchedule)
+				admin.PUT("/fees/:id", controllers.UpdateFeeSchedule)
+				admin.DELETE("/fees/:id", controllers.DeleteFeeSchedule)
 			}
 		}
 	}
@@ -0,0 +1,242 @@
+// Package webhooks delivers signed event notifications to user registered HTTP endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+	"github.com/Santannafe12/pagcore-backend/outbox"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventPing       = "webhook.ping" // Sent on demand to test an endpoint, no subscription needed
+	SignatureHeader = "PagCore-Signature"
+	MaxAttempts     = 8
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = 6 * time.Hour
+	batchSize       = 20
+	// How long a claimed delivery is kept from other runs, well above the client timeout
+	claimLease = time.Minute
+)
+
+// Events lists the outbox event types endpoints can subscribe to.
+var Events = []string{
+	outbox.EventTransferReceived,
+	outbox.EventQRPaid,
+	outbox.EventPaymentRequestCreated,
+	outbox.EventPaymentRequestAccepted,
+	outbox.EventPaymentRequestDeclined,
+	outbox.EventPaymentRequestCancelled,
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Event is the JSON body of every delivery.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func NewSecret() (string, error) {
+	s, err := randomHex(24)
+	return "whsec_" + s, err
+}
+
+func NewEventID() (string, error) {
+	s, err := randomHex(16)
+	return "evt_" + s, err
+}
+
+// Sign returns the PagCore-Signature header value. Receivers recompute the HMAC-SHA256 of
+// "<t>.<body>" with the endpoint secret and compare it to v1.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Subscribed reports whether the endpoint wants the event type.
+func Subscribed(endpoint *models.WebhookEndpoint, eventType string) bool {
+	for _, e := range strings.Split(endpoint.Events, ",") {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidEvent reports whether endpoints can subscribe to the event type.
+func ValidEvent(eventType string) bool {
+	for _, e := range Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sink turns relayed outbox events into deliveries for the subscribed endpoints of the user the
+// event is addressed to. The event id is derived from the outbox id, so receivers can dedupe.
+type Sink struct{}
+
+var _ outbox.Sink = Sink{}
+
+func (Sink) Name() string { return "webhooks" }
+
+func (Sink) Publish(tx *gorm.DB, e *models.OutboxEvent) error {
+	return Enqueue(tx, e.UserID, Event{
+		ID:        fmt.Sprintf("evt_%d", e.ID),
+		Type:      e.EventType,
+		CreatedAt: e.CreatedAt,
+		Data:      json.RawMessage(e.Payload),
+	})
+}
+
+// Enqueue queues the event for every active endpoint of the user subscribed to it.
+func Enqueue(tx *gorm.DB, userID uint, event Event) error {
+	var endpoints []models.WebhookEndpoint
+	if err := tx.Where("user_id = ? AND active = ?", userID, true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+	for i := range endpoints {
+		if !Subscribed(&endpoints[i], event.Type) {
+			continue
+		}
+		if err := EnqueueTo(tx, &endpoints[i], event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueTo queues the event for one endpoint regardless of its subscriptions.
+func EnqueueTo(tx *gorm.DB, endpoint *models.WebhookEndpoint, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.WebhookDelivery{
+		EndpointID:    endpoint.ID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Payload:       string(body),
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: time.Now().UTC(),
+	}).Error
+}
+
+// Backoff is the wait before the next attempt after the given number of failures:
+// 30s, 1m, 2m, 4m... capped at six hours.
+func Backoff(failures int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// send posts the delivery once and returns the response status code.
+func send(d *models.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, d.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PagCore-Webhooks/1.0")
+	req.Header.Set("PagCore-Event", d.EventType)
+	req.Header.Set("PagCore-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(d.Endpoint.Secret, time.Now().Unix(), body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// DeliverDue sends the pending deliveries whose next attempt is due, oldest first. Failures are
+// retried with exponential backoff and dead-lettered after MaxAttempts. It runs as a job with
+// its own transactions: the batch is claimed and committed before any request goes out, and
+// each result is recorded on its own, so no transaction stays open while endpoints answer.
+func DeliverDue(db *gorm.DB) (int64, error) {
+	due, err := claimDue(db)
+	if err != nil {
+		return 0, err
+	}
+	var delivered int64
+	for i := range due {
+		d := &due[i]
+		code, sendErr := send(d)
+		now := time.Now().UTC()
+		updates := map[string]interface{}{"attempts": d.Attempts + 1, "last_status_code": code, "last_error": ""}
+		switch {
+		case sendErr == nil:
+			updates["status"] = models.WebhookDeliverySucceeded
+			updates["delivered_at"] = now
+			delivered++
+		case d.Attempts+1 >= MaxAttempts:
+			updates["status"] = models.WebhookDeliveryDead
+			updates["last_error"] = sendErr.Error()
+		default:
+			updates["next_attempt_at"] = now.Add(Backoff(d.Attempts + 1))
+			updates["last_error"] = sendErr.Error()
+		}
+		if err := db.Model(d).Updates(updates).Error; err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// claimDue picks the due deliveries of active endpoints and pushes their next attempt out by
+// claimLease, so if the process dies mid-send they are retried once the lease runs out.
+func claimDue(db *gorm.DB) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.Joins("Endpoint").
+			Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ? AND \"Endpoint\".active = ?", models.WebhookDeliveryPending, now, true).
+			Order("webhook_deliveries.next_attempt_at, webhook_deliveries.id").Limit(batchSize).Find(&due).Error
+		if err != nil || len(due) == 0 {
+			return err
+		}
+		ids := make([]uint, len(due))
+		for i := range due {
+			ids[i] = due[i].ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(claimLease)).Error
+	})
+	return due, err
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Santannafe12/pagcore-backend/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{"json body", "whsec_test", 1700000000, `{"id":"evt_1","type":"transfer.received"}`},
+		{"empty body", "whsec_test", 1700000000, ""},
+		{"other secret", "whsec_other", 1, "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write([]byte(strconv.FormatInt(tt.timestamp, 10) + "." + tt.body))
+			want := "t=" + strconv.FormatInt(tt.timestamp, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != want {
+				t.Errorf("Sign = %q, want %q", got, want)
+			}
+		})
+	}
+	if Sign("a", 1, []byte("body")) == Sign("b", 1, []byte("body")) {
+		t.Error("different secrets gave the same signature")
+	}
+	if Sign("a", 1, []byte("body")) == Sign("a", 2, []byte("body")) {
+		t.Error("different timestamps gave the same signature")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{MaxAttempts, 64 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.failures); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestSendRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantCode int
+		wantErr  bool
+	}{
+		{"accepted", http.StatusOK, http.StatusOK, false},
+		{"no content", http.StatusNoContent, http.StatusNoContent, false},
+		{"server error", http.StatusInternalServerError, http.StatusInternalServerError, true},
+		{"not modified counts as a failure", http.StatusNotModified, http.StatusNotModified, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const secret = "whsec_roundtrip"
+			payload := `{"id":"evt_42","type":"transfer.received","data":{"amount":10}}`
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != payload {
+					t.Errorf("body = %s, want %s", body, payload)
+				}
+				if got := r.Header.Get("PagCore-Event"); got != "transfer.received" {
+					t.Errorf("PagCore-Event = %q", got)
+				}
+				if got := r.Header.Get("PagCore-Delivery"); got != "7" {
+					t.Errorf("PagCore-Delivery = %q", got)
+				}
+				// Verify the signature the way a receiver would
+				var ts int64
+				for _, part := range strings.Split(r.Header.Get(SignatureHeader), ",") {
+					if v, ok := strings.CutPrefix(part, "t="); ok {
+						ts, _ = strconv.ParseInt(v, 10, 64)
+					}
+				}
+				if r.Header.Get(SignatureHeader) != Sign(secret, ts, body) {
+					t.Errorf("signature %q does not verify", r.Header.Get(SignatureHeader))
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			d := &models.WebhookDelivery{
+				ID:        7,
+				EventType: "transfer.received",
+				Payload:   payload,
+				Endpoint:  models.WebhookEndpoint{URL: server.URL, Secret: secret},
+			}
+			code, err := send(d)
+			if code != tt.wantCode {
+				t.Errorf("code = %d, want %d", code, tt.wantCode)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	endpoint := &models.WebhookEndpoint{Events: "transfer.received,qr.paid"}
+	tests := []struct {
+		event string
+		want  bool
+	}{
+		{"transfer.received", true},
+		{"qr.paid", true},
+		{"payment_request.created", false},
+		{"qr", false},
+	}
+	for _, tt := range tests {
+		if got := Subscribed(endpoint, tt.event); got != tt.want {
+			t.Errorf("Subscribed(%q) = %t, want %t", tt.event, got, tt.want)
+		}
+	}
+}